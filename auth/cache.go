@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	authCacheSaltFilename string = "salt"
+	authCacheSaltSize     int    = 32
+	authCacheEntrySuffix  string = ".json"
+
+	// argon2id parameters recommended by OWASP, it takes tens of milliseconds per auth
+	authCacheKDFTime    uint32 = 2
+	authCacheKDFMemory  uint32 = 19 * 1024 // KiB
+	authCacheKDFThreads uint8  = 1
+	authCacheKDFKeySize uint32 = 32
+)
+
+// authCacheEntry is a cached successful auth result, or a cached catalog query result of the user
+type authCacheEntry struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	// Host is the iRODS host that accepted the credential
+	Host string `json:"host,omitempty"`
+	// EncryptedSessionToken is a PAM session token encrypted with a key derived from the credential
+	EncryptedSessionToken string `json:"encrypted_session_token,omitempty"`
+
+	// for public key auth
+	KeySource             string `json:"key_source,omitempty"`
+	AuthorizedKeyLine     string `json:"authorized_key_line,omitempty"`
+	LineNumber            int    `json:"line_number,omitempty"`
+	SameTypeHomeKeys      int    `json:"same_type_home_keys,omitempty"`
+	AuthorizedKeysVersion string `json:"authorized_keys_version,omitempty"`
+
+	// for shared with me mounts
+	SharedCollections []SharedCollection `json:"shared_collections,omitempty"`
+}
+
+// authCache is a file-backed cache of successful auth results, shared by concurrent hook processes.
+// Entries are stored in a dir per user, named by keys derived from the user name, the credential and the client IP with a salt.
+type authCache struct {
+	dir  string
+	ttl  time.Duration
+	salt []byte
+}
+
+// newAuthCache returns an authCache, or nil if the cache is disabled or not available
+func newAuthCache(config *commons.Config) *authCache {
+	if !config.IsAuthCacheEnabled() {
+		return nil
+	}
+
+	err := os.MkdirAll(config.AuthCacheDir, 0700)
+	if err != nil {
+		log.WithError(err).Warnf("failed to create auth cache dir %q, not using the cache", config.AuthCacheDir)
+		return nil
+	}
+
+	salt, err := readAuthCacheSalt(config.AuthCacheDir)
+	if err != nil {
+		log.WithError(err).Warnf("failed to read auth cache salt, not using the cache")
+		return nil
+	}
+
+	return &authCache{
+		dir:  config.AuthCacheDir,
+		ttl:  time.Duration(config.AuthCacheTTL) * time.Second,
+		salt: salt,
+	}
+}
+
+// readAuthCacheSalt reads the salt of the cache dir, creating it if not exist.
+// The salt is linked in place only when complete, so concurrent processes agree on a single salt.
+func readAuthCacheSalt(dir string) ([]byte, error) {
+	saltPath := filepath.Join(dir, authCacheSaltFilename)
+
+	salt, err := os.ReadFile(saltPath)
+	if err == nil && len(salt) == authCacheSaltSize {
+		return salt, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	newSalt := make([]byte, authCacheSaltSize)
+	rand.Read(newSalt)
+
+	tempFile, err := os.CreateTemp(dir, authCacheSaltFilename+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(newSalt)
+	if err != nil {
+		tempFile.Close()
+		return nil, err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Link(tempFile.Name(), saltPath)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	salt, err = os.ReadFile(saltPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(salt) != authCacheSaltSize {
+		return nil, fmt.Errorf("auth cache salt %q is corrupted", saltPath)
+	}
+	return salt, nil
+}
+
+func (cache *authCache) hash(values ...string) string {
+	hash := sha256.New()
+	hash.Write(cache.salt)
+	for _, value := range values {
+		// separate values so that different splits do not collide
+		hash.Write([]byte(value))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (cache *authCache) getUserDir(username string) string {
+	return filepath.Join(cache.dir, cache.hash("user", username))
+}
+
+// authCacheKey locates an entry and encrypts its session token, derived from a credential
+type authCacheKey struct {
+	username        string
+	entryPath       string
+	sessionTokenKey []byte
+}
+
+// getKey returns an authCacheKey of the user for the name, for results not depending on credentials
+func (cache *authCache) getKey(username string, name string) *authCacheKey {
+	return &authCacheKey{
+		username:  username,
+		entryPath: filepath.Join(cache.getUserDir(username), cache.hash(name)+authCacheEntrySuffix),
+	}
+}
+
+// deriveKey derives an authCacheKey from the credential with argon2id.
+// A slow KDF makes it expensive to guess credentials from entry names, even with the salt next to them.
+func (cache *authCache) deriveKey(username string, credential string, clientIP string) *authCacheKey {
+	password := []byte(username + "\x00" + credential + "\x00" + clientIP)
+	derived := argon2.IDKey(password, cache.salt, authCacheKDFTime, authCacheKDFMemory, authCacheKDFThreads, authCacheKDFKeySize*2)
+
+	return &authCacheKey{
+		username:        username,
+		entryPath:       filepath.Join(cache.getUserDir(username), hex.EncodeToString(derived[:authCacheKDFKeySize])+authCacheEntrySuffix),
+		sessionTokenKey: derived[authCacheKDFKeySize:],
+	}
+}
+
+// get returns an unexpired entry for the credential
+func (cache *authCache) get(key *authCacheKey) (*authCacheEntry, bool) {
+	entryPath := key.entryPath
+
+	data, err := os.ReadFile(entryPath)
+	if err != nil {
+		return nil, false
+	}
+
+	entry := authCacheEntry{}
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		log.WithError(err).Debugf("failed to parse auth cache entry %q", entryPath)
+		os.Remove(entryPath)
+		return nil, false
+	}
+
+	if time.Now().After(entry.ExpiresAt) {
+		os.Remove(entryPath)
+		return nil, false
+	}
+
+	return &entry, true
+}
+
+// put stores an entry for the credential, replacing the existing one atomically
+func (cache *authCache) put(key *authCacheKey, entry *authCacheEntry) {
+	entry.ExpiresAt = time.Now().Add(cache.ttl)
+
+	err := cache.write(key, entry)
+	if err != nil {
+		log.WithError(err).Warnf("failed to write auth cache entry for the user '%s'", key.username)
+	}
+}
+
+func (cache *authCache) write(key *authCacheKey, entry *authCacheEntry) error {
+	userDir := filepath.Dir(key.entryPath)
+	err := os.MkdirAll(userDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(userDir, "entry.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(data)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), key.entryPath)
+}
+
+// remove removes the entry for the credential
+func (cache *authCache) remove(key *authCacheKey) {
+	os.Remove(key.entryPath)
+}
+
+// invalidateUser removes all entries of the user
+func (cache *authCache) invalidateUser(username string) {
+	err := os.RemoveAll(cache.getUserDir(username))
+	if err != nil {
+		log.WithError(err).Warnf("failed to invalidate auth cache for the user '%s'", username)
+	}
+}
+
+// sealSessionToken encrypts a session token with a key derived from the credential, not to store it in clear
+func (cache *authCache) sealSessionToken(key *authCacheKey, sessionToken string) (string, error) {
+	gcm, err := makeSessionTokenCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+
+	return hex.EncodeToString(gcm.Seal(nonce, nonce, []byte(sessionToken), nil)), nil
+}
+
+// openSessionToken decrypts a session token encrypted by sealSessionToken
+func (cache *authCache) openSessionToken(key *authCacheKey, encryptedSessionToken string) (string, error) {
+	gcm, err := makeSessionTokenCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := hex.DecodeString(encryptedSessionToken)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted session token is too short")
+	}
+
+	sessionToken, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(sessionToken), nil
+}
+
+func makeSessionTokenCipher(key *authCacheKey) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.sessionTokenKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+func newTestCacheConfig(t *testing.T) *commons.Config {
+	return &commons.Config{
+		IRODSHost:            "irods.example.com",
+		IRODSAuthScheme:      "pam",
+		IRODSPAMOTPSeparator: "|",
+		IRODSProxyUsername:   "proxy",
+		IRODSProxyPassword:   "proxy_password",
+		AuthCacheDir:         t.TempDir(),
+		AuthCacheTTL:         60,
+		SFTPGoAuthdUsername:  "user1",
+		SFTPGoAuthdPassword:  "password",
+		SFTPGoAuthdIP:        "192.0.2.1",
+	}
+}
+
+func TestAuthCacheSaltIsShared(t *testing.T) {
+	config := newTestCacheConfig(t)
+
+	salts := make([]string, 8)
+	var wg sync.WaitGroup
+	for idx := range salts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache := newAuthCache(config)
+			if cache != nil {
+				salts[idx] = string(cache.salt)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for idx, salt := range salts {
+		if len(salt) == 0 || salt != salts[0] {
+			t.Fatalf("process %d got a different salt", idx)
+		}
+	}
+}
+
+func TestPasswordAuthCache(t *testing.T) {
+	config := newTestCacheConfig(t)
+	cache := newPasswordAuthCache(config)
+	if cache == nil {
+		t.Fatal("cache is not available")
+	}
+
+	cacheKey := cache.deriveKey(config.SFTPGoAuthdUsername, config.SFTPGoAuthdPassword, config.SFTPGoAuthdIP)
+	putCachedPasswordAuth(config, cache, cacheKey, "", config.IRODSHost)
+
+	_, host, ok := getCachedPasswordAuth(config, cache, cacheKey)
+	if !ok || host != config.IRODSHost {
+		t.Fatalf("cached password auth is not found, host = %q", host)
+	}
+
+	otherKey := cache.deriveKey(config.SFTPGoAuthdUsername, "wrong password", config.SFTPGoAuthdIP)
+	if _, _, ok := getCachedPasswordAuth(config, cache, otherKey); ok {
+		t.Errorf("cached password auth is found for a wrong password")
+	}
+
+	otherKey = cache.deriveKey(config.SFTPGoAuthdUsername, config.SFTPGoAuthdPassword, "192.0.2.2")
+	if _, _, ok := getCachedPasswordAuth(config, cache, otherKey); ok {
+		t.Errorf("cached password auth is found for another client IP")
+	}
+
+	other := *config
+	other.IRODSHost = "other.example.com"
+	if _, _, ok := getCachedPasswordAuth(&other, cache, cacheKey); ok {
+		t.Errorf("cached password auth is found for a host not configured")
+	}
+
+	cache.invalidateUser(config.SFTPGoAuthdUsername)
+	if _, _, ok := getCachedPasswordAuth(config, cache, cacheKey); ok {
+		t.Errorf("cached password auth is found after invalidation")
+	}
+}
+
+func TestPasswordAuthCacheSessionToken(t *testing.T) {
+	config := newTestCacheConfig(t)
+	config.IRODSPAMSessionToken = true
+	cache := newPasswordAuthCache(config)
+
+	cacheKey := cache.deriveKey(config.SFTPGoAuthdUsername, config.SFTPGoAuthdPassword, config.SFTPGoAuthdIP)
+	putCachedPasswordAuth(config, cache, cacheKey, "session token", config.IRODSHost)
+
+	sessionToken, _, ok := getCachedPasswordAuth(config, cache, cacheKey)
+	if !ok || sessionToken != "session token" {
+		t.Fatalf("session token = %q, found = %t", sessionToken, ok)
+	}
+
+	entry, ok := cache.get(cacheKey)
+	if !ok || entry.EncryptedSessionToken == "session token" {
+		t.Errorf("session token is stored in clear")
+	}
+
+	// a key derived from another credential must not decrypt the token
+	otherKey := cache.deriveKey(config.SFTPGoAuthdUsername, "wrong password", config.SFTPGoAuthdIP)
+	if _, err := cache.openSessionToken(otherKey, entry.EncryptedSessionToken); err == nil {
+		t.Errorf("session token is decrypted with a wrong password")
+	}
+}
+
+func TestAuthCacheDeriveKey(t *testing.T) {
+	config := newTestCacheConfig(t)
+	cache := newAuthCache(config)
+
+	key := cache.deriveKey("user1", "password", "192.0.2.1")
+	if again := cache.deriveKey("user1", "password", "192.0.2.1"); again.entryPath != key.entryPath || string(again.sessionTokenKey) != string(key.sessionTokenKey) {
+		t.Errorf("key is not deterministic")
+	}
+
+	// values must be separated, so that different splits do not collide
+	if other := cache.deriveKey("user1", "password192.0.2.1", ""); other.entryPath == key.entryPath {
+		t.Errorf("different splits of values collide")
+	}
+
+	if strings.Contains(key.entryPath, hex.EncodeToString(key.sessionTokenKey)) {
+		t.Errorf("session token key is exposed in the entry path")
+	}
+
+	otherCache := &authCache{dir: cache.dir, ttl: cache.ttl, salt: make([]byte, authCacheSaltSize)}
+	if other := otherCache.deriveKey("user1", "password", "192.0.2.1"); other.entryPath == key.entryPath {
+		t.Errorf("key does not depend on the salt")
+	}
+}
+
+func TestPasswordAuthCacheSkipsOneTimeCodes(t *testing.T) {
+	tests := []struct {
+		name                string
+		authScheme          string
+		separator           string
+		password            string
+		keyboardInteractive string
+		cached              bool
+	}{
+		{"password without separator configured", "pam", "", "password", "", false},
+		{"password with separator configured", "pam", "|", "password", "", true},
+		{"password with one-time code", "pam", "|", "password|123456", "", false},
+		{"keyboard interactive", "pam", "|", "password|123456", "1", false},
+		{"keyboard interactive without separator", "pam", "", "password123456", "1", false},
+		{"native auth does not use one-time codes", "native", "|", "pass|word", "", true},
+		{"native auth without separator configured", "native", "", "password", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newTestCacheConfig(t)
+			config.IRODSAuthScheme = test.authScheme
+			config.IRODSPAMOTPSeparator = test.separator
+			config.SFTPGoAuthdPassword = test.password
+			config.SFTPGoAuthdKeyboardInteractive = test.keyboardInteractive
+
+			cache := newPasswordAuthCache(config)
+			if (cache != nil) != test.cached {
+				t.Errorf("cached = %t, want %t", cache != nil, test.cached)
+			}
+		})
+	}
+}
+
+func TestPasswordAuthCacheOneTimeCodeReplay(t *testing.T) {
+	config := newTestCacheConfig(t)
+	config.IRODSPAMOTPSeparator = "|"
+	config.SFTPGoAuthdPassword = "password|123456"
+
+	// an entry written by a version that cached one-time codes must not be used
+	cache := newAuthCache(config)
+	cacheKey := cache.deriveKey(config.SFTPGoAuthdUsername, config.SFTPGoAuthdPassword, config.SFTPGoAuthdIP)
+	putCachedPasswordAuth(config, cache, cacheKey, "", config.IRODSHost)
+	if _, _, ok := getCachedPasswordAuth(config, cache, cacheKey); !ok {
+		t.Fatal("cached password auth is not found")
+	}
+
+	if newPasswordAuthCache(config) != nil {
+		t.Errorf("one-time code is accepted again from the cache")
+	}
+}
+
+func TestAuthCacheDisabled(t *testing.T) {
+	config := newTestCacheConfig(t)
+	config.AuthCacheTTL = 0
+	if newAuthCache(config) != nil {
+		t.Errorf("cache is enabled without TTL")
+	}
+
+	config = newTestCacheConfig(t)
+	config.AuthCacheDir = ""
+	if newAuthCache(config) != nil {
+		t.Errorf("cache is enabled without a dir")
+	}
+}
+
+func TestAuthViaPasswordCachedDoesNotConnect(t *testing.T) {
+	config := newTestCacheConfig(t)
+	cache := newPasswordAuthCache(config)
+
+	cacheKey := cache.deriveKey(config.SFTPGoAuthdUsername, config.SFTPGoAuthdPassword, config.SFTPGoAuthdIP)
+	putCachedPasswordAuth(config, cache, cacheKey, "", config.IRODSHost)
+
+	// any connection, to log in or to create .ssh dir, fails with the canceled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	catalog := NewIRODSCatalogClient(ctx, config)
+	defer catalog.Close()
+
+	loggedIn, _, host, err := AuthViaPassword(ctx, config, catalog)
+	if err != nil || !loggedIn {
+		t.Fatalf("cached password auth is not used: logged in = %t, err = %v", loggedIn, err)
+	}
+	if host != config.IRODSHost {
+		t.Errorf("host = %q, want %q", host, config.IRODSHost)
+	}
+}
+
+func TestPasswordAuthCacheWithoutProxy(t *testing.T) {
+	config := newTestCacheConfig(t)
+	config.IRODSProxyUsername = ""
+	config.IRODSProxyPassword = ""
+
+	if newPasswordAuthCache(config) != nil {
+		t.Errorf("PAM password auth is cached without proxy or session token")
+	}
+
+	config.IRODSPAMSessionToken = true
+	if newPasswordAuthCache(config) == nil {
+		t.Errorf("PAM password auth is not cached with session token")
+	}
+
+	config.IRODSPAMSessionToken = false
+	config.IRODSAuthScheme = "native"
+	if newPasswordAuthCache(config) == nil {
+		t.Errorf("native password auth is not cached without proxy")
+	}
+}
+
+func TestAuthViaPasswordCachedSessionToken(t *testing.T) {
+	config := newTestCacheConfig(t)
+	config.IRODSProxyUsername = ""
+	config.IRODSProxyPassword = ""
+	config.IRODSPAMSessionToken = true
+	cache := newPasswordAuthCache(config)
+
+	cacheKey := cache.deriveKey(config.SFTPGoAuthdUsername, config.SFTPGoAuthdPassword, config.SFTPGoAuthdIP)
+	putCachedPasswordAuth(config, cache, cacheKey, "session token", config.IRODSHost)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	catalog := NewIRODSCatalogClient(ctx, config)
+	defer catalog.Close()
+
+	loggedIn, sessionToken, _, err := AuthViaPassword(ctx, config, catalog)
+	if err != nil || !loggedIn || sessionToken != "session token" {
+		t.Fatalf("cached password auth is not used: logged in = %t, session token = %q, err = %v", loggedIn, sessionToken, err)
+	}
+	if catalog.sessionToken != "session token" {
+		t.Errorf("catalog does not log in with the session token")
+	}
+
+	account, err := makeIRODSAccountForSessionToken(config, catalog.sessionToken)
+	if err != nil {
+		t.Fatalf("failed to make an account: %v", err)
+	}
+	if account.AuthenticationScheme != "native" || account.Password != "session token" {
+		t.Errorf("account logs in with %s auth", account.AuthenticationScheme)
+	}
+}
@@ -0,0 +1,539 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
+	irodsclient_conn "github.com/cyverse/go-irodsclient/irods/connection"
+	irodsclient_fs "github.com/cyverse/go-irodsclient/irods/fs"
+	irodsclient_message "github.com/cyverse/go-irodsclient/irods/message"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// irodsAccessLevels are iRODS access levels in increasing order, a level includes lower levels
+var irodsAccessLevels = []irodsclient_types.IRODSAccessLevelType{
+	irodsclient_types.IRODSAccessLevelNull,
+	irodsclient_types.IRODSAccessLevelExecute,
+	irodsclient_types.IRODSAccessLevelReadAnnotation,
+	irodsclient_types.IRODSAccessLevelReadSystemMetadata,
+	irodsclient_types.IRODSAccessLevelReadMetadata,
+	irodsclient_types.IRODSAccessLevelReadObject,
+	irodsclient_types.IRODSAccessLevelWriteAnnotation,
+	irodsclient_types.IRODSAccessLevelCreateMetadata,
+	irodsclient_types.IRODSAccessLevelModifyMetadata,
+	irodsclient_types.IRODSAccessLevelDeleteMetadata,
+	irodsclient_types.IRODSAccessLevelAdministerObject,
+	irodsclient_types.IRODSAccessLevelCreateObject,
+	irodsclient_types.IRODSAccessLevelModifyObject,
+	irodsclient_types.IRODSAccessLevelDeleteObject,
+	irodsclient_types.IRODSAccessLevelCreateToken,
+	irodsclient_types.IRODSAccessLevelDeleteToken,
+	irodsclient_types.IRODSAccessLevelCurate,
+	irodsclient_types.IRODSAccessLevelOwner,
+}
+
+// isAccessLevelAtLeast checks if the access level includes the required level
+func isAccessLevelAtLeast(accessLevel irodsclient_types.IRODSAccessLevelType, required irodsclient_types.IRODSAccessLevelType) bool {
+	return slices.Index(irodsAccessLevels, accessLevel) >= slices.Index(irodsAccessLevels, required)
+}
+
+// CollectionAccess is an access of a user to a collection, simplified from iRODS access levels
+type CollectionAccess int
+
+const (
+	// CollectionAccessNone is for access levels below read
+	CollectionAccessNone CollectionAccess = iota
+	// CollectionAccessRead is for read
+	CollectionAccessRead
+	// CollectionAccessWrite is for create, write (modify), delete and own
+	CollectionAccessWrite
+)
+
+// getCollectionAccess returns the collection access of the iRODS access level
+func getCollectionAccess(accessLevel irodsclient_types.IRODSAccessLevelType) CollectionAccess {
+	if isAccessLevelAtLeast(accessLevel, irodsclient_types.IRODSAccessLevelCreateObject) {
+		return CollectionAccessWrite
+	}
+	if isAccessLevelAtLeast(accessLevel, irodsclient_types.IRODSAccessLevelReadObject) {
+		return CollectionAccessRead
+	}
+	return CollectionAccessNone
+}
+
+// irodsPublicGroup is the group all iRODS users are members of
+const irodsPublicGroup string = "public"
+
+// SharedCollection is a collection that other users share with a user by ACLs
+type SharedCollection struct {
+	Path   string           `json:"path"`
+	Access CollectionAccess `json:"access"`
+}
+
+// CatalogClient queries the iRODS catalog for making mounts of a user
+type CatalogClient interface {
+	// GetUserType returns the iRODS type of the user, such as rodsuser
+	GetUserType(username string) (string, error)
+	// ListUserGroups returns names of groups the user is a member of
+	ListUserGroups(username string) ([]string, error)
+	// CollectionExists checks if the collection exists
+	CollectionExists(collectionPath string) (bool, error)
+	// ListSharedCollections returns collections readable by the user or the user's groups, out of the user's home, sorted by path
+	ListSharedCollections(username string) ([]SharedCollection, error)
+	// GetCollectionAccess returns the effective access of the user to the collection, given to the user, the user's groups or the public group
+	GetCollectionAccess(username string, collectionPath string) (CollectionAccess, error)
+}
+
+// IRODSCatalogClient is a CatalogClient that queries iRODS
+// It connects on the first query, using the proxy account if given, otherwise the user account
+// Without proxy, password auth hands its login connection to the client, or the session token of a cached login
+type IRODSCatalogClient struct {
+	// ctx is of the auth request the client is made for, queries stop when it is done
+	ctx       context.Context
+	config    *commons.Config
+	irodsConn *irodsclient_conn.IRODSConnection
+	host      string
+	// sessionToken is used instead of the user's password without proxy, if given
+	sessionToken string
+
+	// query results kept for the client's lifetime, a login
+	users    map[string]*irodsclient_types.IRODSUser
+	groups   map[string][]string
+	accesses map[string]CollectionAccess
+}
+
+// NewIRODSCatalogClient returns a new IRODSCatalogClient, it must be closed after use
+func NewIRODSCatalogClient(ctx context.Context, config *commons.Config) *IRODSCatalogClient {
+	return &IRODSCatalogClient{
+		ctx:      ctx,
+		config:   config,
+		users:    map[string]*irodsclient_types.IRODSUser{},
+		groups:   map[string][]string{},
+		accesses: map[string]CollectionAccess{},
+	}
+}
+
+func (client *IRODSCatalogClient) getConnection() (*irodsclient_conn.IRODSConnection, error) {
+	err := client.ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if client.irodsConn != nil {
+		return client.irodsConn, nil
+	}
+
+	var irodsAccount *irodsclient_types.IRODSAccount
+
+	if client.config.IsProxyAuth() {
+		irodsAccount, err = makeIRODSAccountForProxy(client.config)
+	} else if len(client.sessionToken) > 0 {
+		irodsAccount, err = makeIRODSAccountForSessionToken(client.config, client.sessionToken)
+	} else {
+		irodsAccount, err = makeIRODSAccount(client.config)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	irodsConn, host, err := connectIRODS(client.ctx, client.config, irodsAccount)
+	if err != nil {
+		log.Debugf("failed to connect to iRODS for catalog queries")
+		return nil, err
+	}
+
+	client.irodsConn = irodsConn
+	client.host = host
+	return irodsConn, nil
+}
+
+// setConnection makes the client query on the connection, already logged in
+func (client *IRODSCatalogClient) setConnection(irodsConn *irodsclient_conn.IRODSConnection, host string) {
+	client.Close()
+	client.irodsConn = irodsConn
+	client.host = host
+}
+
+// setSessionToken makes the client log in with the PAM session token without proxy
+func (client *IRODSCatalogClient) setSessionToken(sessionToken string) {
+	client.sessionToken = sessionToken
+}
+
+// GetHost returns the iRODS host connected, empty if not connected yet
+func (client *IRODSCatalogClient) GetHost() string {
+	return client.host
+}
+
+// Close disconnects from iRODS if connected
+func (client *IRODSCatalogClient) Close() {
+	if client.irodsConn != nil {
+		client.irodsConn.Disconnect()
+		client.irodsConn = nil
+	}
+}
+
+// getUser returns the user or the group of the name
+func (client *IRODSCatalogClient) getUser(name string) (*irodsclient_types.IRODSUser, error) {
+	if user, ok := client.users[name]; ok {
+		return user, nil
+	}
+
+	irodsConn, err := client.getConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := irodsclient_fs.GetUser(irodsConn, name, client.config.IRODSZone)
+	if err != nil {
+		return nil, err
+	}
+
+	client.users[name] = user
+	return user, nil
+}
+
+// GetUserType returns the iRODS type of the user, such as rodsuser
+func (client *IRODSCatalogClient) GetUserType(username string) (string, error) {
+	user, err := client.getUser(username)
+	if err != nil {
+		return "", err
+	}
+	return string(user.Type), nil
+}
+
+// ListUserGroups returns names of groups the user is a member of, except the user's own group
+func (client *IRODSCatalogClient) ListUserGroups(username string) ([]string, error) {
+	if groups, ok := client.groups[username]; ok {
+		return groups, nil
+	}
+
+	irodsConn, err := client.getConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	groupNames, err := irodsclient_fs.ListUserGroupNames(irodsConn, username, client.config.IRODSZone)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []string{}
+	for _, groupName := range groupNames {
+		// iRODS lists the user itself as a group
+		if groupName != username {
+			groups = append(groups, groupName)
+		}
+	}
+
+	client.groups[username] = groups
+	return groups, nil
+}
+
+// CollectionExists checks if the collection exists
+func (client *IRODSCatalogClient) CollectionExists(collectionPath string) (bool, error) {
+	irodsConn, err := client.getConnection()
+	if err != nil {
+		return false, err
+	}
+
+	collection, err := irodsclient_fs.GetCollection(irodsConn, collectionPath)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return collection.ID > 0, nil
+}
+
+// ListSharedCollections returns collections readable by the user or the user's groups, out of the user's home, sorted by path
+// Ancestors of the user's home, such as the zone and the home root, and the trash are not included.
+// Collections shared with the public group are not included, as they are shared with everyone rather than the user.
+// At most SharedWithMeMaxCollections collections are read, and results are kept in the auth cache if enabled.
+func (client *IRODSCatalogClient) ListSharedCollections(username string) ([]SharedCollection, error) {
+	cache := newAuthCache(client.config)
+	var cacheKey *authCacheKey
+	if cache != nil {
+		cacheKey = cache.getKey(username, "shared_collections")
+		entry, ok := cache.get(cacheKey)
+		if ok {
+			log.Debugf("using cached collections shared with the user '%s'", username)
+			return entry.SharedCollections, nil
+		}
+	}
+
+	irodsConn, err := client.getConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := client.ListUserGroups(username)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := []string{}
+	for _, name := range append([]string{username}, groups...) {
+		if name == irodsPublicGroup {
+			continue
+		}
+
+		user, err := client.getUser(name)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, fmt.Sprintf("'%d'", user.ID))
+	}
+
+	zonePath := path.Join("/", client.config.IRODSZone)
+	homePath := path.Join(zonePath, "home", username)
+	trashPath := path.Join(zonePath, "trash")
+
+	maxCollections := client.config.SharedWithMeMaxCollections
+	accessLevels, err := queryCollectionAccesses(irodsConn, userIDs, homePath, maxCollections)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxCollections > 0 && len(accessLevels) >= maxCollections {
+		log.Warnf("collections shared with the user '%s' are limited to %d, some may not be listed", username, maxCollections)
+	}
+
+	sharedCollections := []SharedCollection{}
+	for collectionPath, accessLevel := range accessLevels {
+		access := getCollectionAccess(accessLevel)
+		if access == CollectionAccessNone {
+			continue
+		}
+
+		if commons.IsPathUnder(collectionPath, homePath) || commons.IsPathUnder(collectionPath, trashPath) || commons.IsPathUnder(homePath, collectionPath) {
+			continue
+		}
+
+		sharedCollections = append(sharedCollections, SharedCollection{
+			Path:   collectionPath,
+			Access: access,
+		})
+	}
+
+	sort.Slice(sharedCollections, func(i int, j int) bool {
+		return sharedCollections[i].Path < sharedCollections[j].Path
+	})
+
+	if cache != nil {
+		cache.put(cacheKey, &authCacheEntry{
+			SharedCollections: sharedCollections,
+		})
+	}
+	return sharedCollections, nil
+}
+
+// GetCollectionAccess returns the effective access of the user to the collection, given to the user, the user's groups or the public group
+// rodsadmin users have write access to all collections. For a collection not existing, the access is from the nearest existing ancestor:
+// write if the user can create the collection there, as the creator owns it, otherwise the access the collection would inherit
+func (client *IRODSCatalogClient) GetCollectionAccess(username string, collectionPath string) (CollectionAccess, error) {
+	accessKey := username + "\x00" + collectionPath
+	if access, ok := client.accesses[accessKey]; ok {
+		return access, nil
+	}
+
+	access, err := client.getCollectionAccess(username, collectionPath)
+	if err != nil {
+		return CollectionAccessNone, err
+	}
+
+	client.accesses[accessKey] = access
+	return access, nil
+}
+
+func (client *IRODSCatalogClient) getCollectionAccess(username string, collectionPath string) (CollectionAccess, error) {
+	user, err := client.getUser(username)
+	if err != nil {
+		return CollectionAccessNone, err
+	}
+
+	if user.IsAdminUser() {
+		return CollectionAccessWrite, nil
+	}
+
+	groups, err := client.ListUserGroups(username)
+	if err != nil {
+		return CollectionAccessNone, err
+	}
+
+	// all users are members of the public group, even if not listed
+	names := append([]string{username, irodsPublicGroup}, groups...)
+
+	irodsConn, err := client.getConnection()
+	if err != nil {
+		return CollectionAccessNone, err
+	}
+
+	for currentPath := collectionPath; ; currentPath = path.Dir(currentPath) {
+		accessLevel, exists, err := getCollectionAccessLevel(irodsConn, currentPath, names, client.config.IRODSZone)
+		if err != nil {
+			return CollectionAccessNone, err
+		}
+
+		if exists {
+			access := getCollectionAccess(accessLevel)
+			if currentPath == collectionPath || access == CollectionAccessWrite {
+				return access, nil
+			}
+
+			inheritance, err := irodsclient_fs.GetCollectionAccessInheritance(irodsConn, currentPath)
+			if err != nil {
+				return CollectionAccessNone, err
+			}
+
+			if !inheritance.Inheritance {
+				return CollectionAccessNone, nil
+			}
+
+			log.Debugf("collection %q does not exist, using access inherited from %q", collectionPath, currentPath)
+			return access, nil
+		}
+
+		// no access rows are visible for collections without access too
+		collectionExists, err := client.CollectionExists(currentPath)
+		if err != nil {
+			return CollectionAccessNone, err
+		}
+
+		if collectionExists || currentPath == "/" {
+			return CollectionAccessNone, nil
+		}
+	}
+}
+
+// getCollectionAccessLevel returns the highest access level of the users or groups of the names to the collection, and if the collection exists
+func getCollectionAccessLevel(irodsConn *irodsclient_conn.IRODSConnection, collectionPath string, names []string, zone string) (irodsclient_types.IRODSAccessLevelType, bool, error) {
+	accesses, err := irodsclient_fs.ListCollectionAccesses(irodsConn, collectionPath)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			return irodsclient_types.IRODSAccessLevelNull, false, nil
+		}
+		return irodsclient_types.IRODSAccessLevelNull, false, err
+	}
+
+	accessLevel := irodsclient_types.IRODSAccessLevelNull
+	for _, access := range accesses {
+		if access.UserZone != zone || !slices.Contains(names, access.UserName) {
+			continue
+		}
+
+		if !isAccessLevelAtLeast(accessLevel, access.AccessLevel) {
+			accessLevel = access.AccessLevel
+		}
+	}
+
+	return accessLevel, true, nil
+}
+
+// queryCollectionAccesses returns the highest access levels of the users to collections, except collections under the excluded path
+// It stops reading when maxCollections collections are read, if maxCollections is positive
+func queryCollectionAccesses(irodsConn *irodsclient_conn.IRODSConnection, userIDs []string, excludedPath string, maxCollections int) (map[string]irodsclient_types.IRODSAccessLevelType, error) {
+	irodsConn.Lock()
+	defer irodsConn.Unlock()
+
+	accessLevels := map[string]irodsclient_types.IRODSAccessLevelType{}
+
+	continueIndex := 0
+	for {
+		query := irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, continueIndex, 0, 0)
+		query.AddSelect(irodsclient_common.ICAT_COLUMN_COLL_NAME)
+		query.AddSelect(irodsclient_common.ICAT_COLUMN_COLL_ACCESS_NAME)
+		query.AddCondition(irodsclient_common.ICAT_COLUMN_COLL_ACCESS_USER_ID, fmt.Sprintf("in (%s)", strings.Join(userIDs, ", ")))
+		if !strings.Contains(excludedPath, "'") {
+			query.AddCondition(irodsclient_common.ICAT_COLUMN_COLL_NAME, fmt.Sprintf("not like '%s/%%'", escapeLikePattern(excludedPath)))
+		}
+		// otherwise, quotes cannot be escaped in GenQuery, callers filter out the excluded path
+
+		queryResult := irodsclient_message.IRODSMessageQueryResponse{}
+		err := irodsConn.Request(query, &queryResult, nil, irodsConn.GetLongResponseOperationTimeout())
+		if err == nil {
+			err = queryResult.CheckError()
+		}
+		if err != nil {
+			if irodsclient_types.GetIRODSErrorCode(err) == irodsclient_common.CAT_NO_ROWS_FOUND {
+				break
+			}
+			return nil, fmt.Errorf("failed to query collection accesses: %w", err)
+		}
+
+		if queryResult.RowCount == 0 {
+			break
+		}
+
+		paths := make([]string, queryResult.RowCount)
+		levels := make([]irodsclient_types.IRODSAccessLevelType, queryResult.RowCount)
+		for _, sqlResult := range queryResult.SQLResult {
+			if len(sqlResult.Values) != queryResult.RowCount {
+				return nil, fmt.Errorf("failed to query collection accesses, received %d values for %d rows", len(sqlResult.Values), queryResult.RowCount)
+			}
+
+			for row, value := range sqlResult.Values {
+				switch sqlResult.AttributeIndex {
+				case int(irodsclient_common.ICAT_COLUMN_COLL_NAME):
+					paths[row] = value
+				case int(irodsclient_common.ICAT_COLUMN_COLL_ACCESS_NAME):
+					levels[row] = irodsclient_types.GetIRODSAccessLevelType(value)
+				}
+			}
+		}
+
+		for row, collectionPath := range paths {
+			current, ok := accessLevels[collectionPath]
+			if !ok && maxCollections > 0 && len(accessLevels) >= maxCollections {
+				continue
+			}
+
+			// a user may have accesses via groups too
+			if !ok || !isAccessLevelAtLeast(current, levels[row]) {
+				accessLevels[collectionPath] = levels[row]
+			}
+		}
+
+		if maxCollections > 0 && len(accessLevels) >= maxCollections {
+			if queryResult.ContinueIndex != 0 {
+				// close the query not to leave it open in the server
+				closeQuery(irodsConn, queryResult.ContinueIndex)
+			}
+			break
+		}
+
+		continueIndex = queryResult.ContinueIndex
+		if continueIndex == 0 {
+			break
+		}
+	}
+
+	return accessLevels, nil
+}
+
+// closeQuery closes a paged query that is not read to the end
+func closeQuery(irodsConn *irodsclient_conn.IRODSConnection, continueIndex int) {
+	// a query with no rows closes the query of the continue index
+	query := irodsclient_message.NewIRODSMessageQueryRequest(0, continueIndex, 0, 0)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_COLL_NAME)
+
+	queryResult := irodsclient_message.IRODSMessageQueryResponse{}
+	err := irodsConn.Request(query, &queryResult, nil, irodsConn.GetOperationTimeout())
+	if err != nil {
+		log.WithError(err).Debugf("failed to close query")
+	}
+}
+
+// escapeLikePattern escapes wildcards of SQL LIKE patterns, so that the value matches itself only
+func escapeLikePattern(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+	return replacer.Replace(value)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// fakeCatalog is a CatalogClient of static results
+type fakeCatalog struct {
+	userType string
+	groups   []string
+}
+
+func (catalog *fakeCatalog) GetUserType(username string) (string, error) {
+	return catalog.userType, nil
+}
+
+func (catalog *fakeCatalog) ListUserGroups(username string) ([]string, error) {
+	return catalog.groups, nil
+}
+
+func (catalog *fakeCatalog) CollectionExists(collectionPath string) (bool, error) {
+	return true, nil
+}
+
+func (catalog *fakeCatalog) ListSharedCollections(username string) ([]SharedCollection, error) {
+	return nil, nil
+}
+
+func (catalog *fakeCatalog) GetCollectionAccess(username string, collectionPath string) (CollectionAccess, error) {
+	return CollectionAccessWrite, nil
+}
+
+func TestEscapeLikePattern(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"/zone/home/user1", "/zone/home/user1"},
+		{"/zone/home/user_1", "/zone/home/user\\_1"},
+		{"/zone/home/user%1", "/zone/home/user\\%1"},
+		{"/zone/home/user\\1", "/zone/home/user\\\\1"},
+		{"/zone/home/_%\\", "/zone/home/\\_\\%\\\\"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			if got := escapeLikePattern(test.value); got != test.want {
+				t.Errorf("escapeLikePattern(%q) = %q, want %q", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestListSharedCollectionsCached(t *testing.T) {
+	config := newTestCacheConfig(t)
+	config.IRODSZone = "zone"
+
+	sharedCollections := []SharedCollection{
+		{Path: "/zone/home/user2/project", Access: CollectionAccessRead},
+		{Path: "/zone/home/user3/data", Access: CollectionAccessWrite},
+	}
+
+	cache := newAuthCache(config)
+	cache.put(cache.getKey("user1", "shared_collections"), &authCacheEntry{
+		SharedCollections: sharedCollections,
+	})
+
+	// a cached result is returned without connecting to iRODS
+	client := NewIRODSCatalogClient(context.Background(), config)
+	defer client.Close()
+
+	got, err := client.ListSharedCollections("user1")
+	if err != nil {
+		t.Fatalf("failed to list shared collections: %v", err)
+	}
+	if !reflect.DeepEqual(got, sharedCollections) {
+		t.Errorf("shared collections = %+v, want %+v", got, sharedCollections)
+	}
+	if client.GetHost() != "" {
+		t.Errorf("connected to iRODS for a cached result")
+	}
+
+	// credential entries do not collide with other entries of the user
+	if cache.getKey("user1", "shared_collections").entryPath == cache.deriveKey("user1", "shared_collections", "").entryPath {
+		t.Errorf("entry paths collide")
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sourceAddressCriticalOption string = "source-address"
+)
+
+// checkCertificate checks if the user certificate is signed by the authority key and valid for the user
+func checkCertificate(cert *ssh.Certificate, authorityKey ssh.PublicKey, options *KeyOptions, username string, clientIP string) error {
+	if cert.CertType != ssh.UserCert {
+		return fmt.Errorf("certificate type %d is not a user certificate", cert.CertType)
+	}
+
+	if !bytes.Equal(cert.SignatureKey.Marshal(), authorityKey.Marshal()) {
+		return errors.New("certificate is not signed by the authority")
+	}
+
+	if len(cert.ValidPrincipals) == 0 {
+		return errors.New("certificate has no principals")
+	}
+
+	principal, err := selectCertificatePrincipal(cert, options, username)
+	if err != nil {
+		return err
+	}
+
+	certChecker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), authorityKey.Marshal())
+		},
+		// source-address is checked below, other critical options like force-command cannot be enforced
+		SupportedCriticalOptions: []string{sourceAddressCriticalOption},
+	}
+
+	// checks principal, validity window, critical options and signature
+	err = certChecker.CheckCert(principal, cert)
+	if err != nil {
+		return err
+	}
+
+	if sourceAddress, ok := cert.CriticalOptions[sourceAddressCriticalOption]; ok {
+		if !matchSourceAddress(clientIP, sourceAddress) {
+			return fmt.Errorf("client %s is not allowed by certificate source-address %s", clientIP, sourceAddress)
+		}
+	}
+
+	return nil
+}
+
+// selectCertificatePrincipal returns a principal to check the certificate with.
+// The certificate must have the username as a principal, or one of principals="" option if given.
+func selectCertificatePrincipal(cert *ssh.Certificate, options *KeyOptions, username string) (string, error) {
+	allowedPrincipals := []string{username}
+	if options.Principals != nil {
+		allowedPrincipals = options.Principals
+	}
+
+	for _, allowedPrincipal := range allowedPrincipals {
+		for _, validPrincipal := range cert.ValidPrincipals {
+			if allowedPrincipal == validPrincipal {
+				return validPrincipal, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("certificate principals %v do not match %v", cert.ValidPrincipals, allowedPrincipals)
+}
+
+// matchSourceAddress checks if the client IP is in comma separated CIDR or IP list
+func matchSourceAddress(clientIP string, sourceAddress string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, address := range strings.Split(sourceAddress, ",") {
+		address = strings.TrimSpace(address)
+		if strings.Contains(address, "/") {
+			_, addressNet, err := net.ParseCIDR(address)
+			if err != nil {
+				continue
+			}
+
+			if addressNet.Contains(ip) {
+				return true
+			}
+		} else if addressIP := net.ParseIP(address); addressIP != nil && addressIP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
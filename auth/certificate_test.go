@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	return signer
+}
+
+// newTestCertificate returns a user certificate of a new key signed by the authority, valid for an hour
+func newTestCertificate(t *testing.T, authority ssh.Signer, modify func(cert *ssh.Certificate)) *ssh.Certificate {
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             newTestSigner(t).PublicKey(),
+		CertType:        ssh.UserCert,
+		KeyId:           "test",
+		ValidPrincipals: []string{"user1"},
+		ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+	}
+
+	if modify != nil {
+		modify(cert)
+	}
+
+	err := cert.SignCert(rand.Reader, authority)
+	if err != nil {
+		t.Fatalf("failed to sign certificate: %v", err)
+	}
+	return cert
+}
+
+func TestCheckCertificate(t *testing.T) {
+	authority := newTestSigner(t)
+	otherAuthority := newTestSigner(t)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		authority ssh.Signer
+		modify    func(cert *ssh.Certificate)
+		options   *KeyOptions
+		clientIP  string
+		wantErr   string
+	}{
+		{"valid", authority, nil, &KeyOptions{}, "192.0.2.1", ""},
+		{"host certificate", authority, func(cert *ssh.Certificate) { cert.CertType = ssh.HostCert }, &KeyOptions{}, "192.0.2.1", "not a user certificate"},
+		{"other authority", otherAuthority, nil, &KeyOptions{}, "192.0.2.1", "not signed by the authority"},
+		{"no principals", authority, func(cert *ssh.Certificate) { cert.ValidPrincipals = nil }, &KeyOptions{}, "192.0.2.1", "no principals"},
+		{"other principal", authority, func(cert *ssh.Certificate) { cert.ValidPrincipals = []string{"user2"} }, &KeyOptions{}, "192.0.2.1", "do not match"},
+		{"principals option", authority, func(cert *ssh.Certificate) { cert.ValidPrincipals = []string{"lab-members"} }, &KeyOptions{Principals: []string{"lab-members"}}, "192.0.2.1", ""},
+		{"principals option replaces the username", authority, nil, &KeyOptions{Principals: []string{"lab-members"}}, "192.0.2.1", "do not match"},
+		{"expired", authority, func(cert *ssh.Certificate) { cert.ValidBefore = uint64(now.Add(-time.Minute).Unix()) }, &KeyOptions{}, "192.0.2.1", "expired"},
+		{"not yet valid", authority, func(cert *ssh.Certificate) { cert.ValidAfter = uint64(now.Add(time.Hour).Unix()) }, &KeyOptions{}, "192.0.2.1", "not yet valid"},
+		{"source address", authority, func(cert *ssh.Certificate) {
+			cert.CriticalOptions = map[string]string{sourceAddressCriticalOption: "10.0.0.0/8, 192.0.2.1"}
+		}, &KeyOptions{}, "192.0.2.1", ""},
+		{"source address not matching", authority, func(cert *ssh.Certificate) {
+			cert.CriticalOptions = map[string]string{sourceAddressCriticalOption: "10.0.0.0/8"}
+		}, &KeyOptions{}, "192.0.2.1", "source-address"},
+		{"unsupported critical option", authority, func(cert *ssh.Certificate) {
+			cert.CriticalOptions = map[string]string{"force-command": "/bin/true"}
+		}, &KeyOptions{}, "192.0.2.1", "unsupported critical option"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cert := newTestCertificate(t, test.authority, test.modify)
+
+			err := checkCertificate(cert, authority.PublicKey(), test.options, "user1", test.clientIP)
+			if len(test.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("certificate is rejected: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("err = %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckAuthorizedKey(t *testing.T) {
+	authority := newTestSigner(t)
+	userKey := newTestSigner(t).PublicKey()
+	cert := newTestCertificate(t, authority, nil)
+
+	authorityLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(authority.PublicKey())))
+	userKeyLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(userKey)))
+
+	tests := []struct {
+		name           string
+		authorizedKeys string
+		userKey        ssh.PublicKey
+		wantLine       int
+	}{
+		{"key", "# comment\n" + userKeyLine + "\n", userKey, 2},
+		{"key with options", `readonly,from="192.0.2.0/24" ` + userKeyLine, userKey, 1},
+		{"line with unknown option is rejected", "no-such-option " + userKeyLine, userKey, 0},
+		{"next line after a rejected line", "no-such-option " + userKeyLine + "\n" + userKeyLine, userKey, 2},
+		{"certificate via cert-authority", "cert-authority " + authorityLine, cert, 1},
+		{"certificate without cert-authority", authorityLine, cert, 0},
+		{"key is not accepted by cert-authority", "cert-authority " + userKeyLine, userKey, 0},
+		{"no keys", "", userKey, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loggedIn, authorizedKey := checkAuthorizedKey([]byte(test.authorizedKeys), test.userKey, "user1", "192.0.2.1")
+			if test.wantLine == 0 {
+				if loggedIn {
+					t.Errorf("key is accepted by line %d", authorizedKey.LineNumber)
+				}
+				return
+			}
+
+			if !loggedIn {
+				t.Fatal("key is not accepted")
+			}
+			if authorizedKey.LineNumber != test.wantLine {
+				t.Errorf("line = %d, want %d", authorizedKey.LineNumber, test.wantLine)
+			}
+		})
+	}
+}
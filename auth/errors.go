@@ -0,0 +1,24 @@
+package auth
+
+import "errors"
+
+var (
+	// ErrInvalidCredentials is returned when iRODS rejects user credentials
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrKeyNotFound is returned when no authorized key matches the user key
+	ErrKeyNotFound = errors.New("no matching authorized key")
+	// ErrKeyExpired is returned when the matched authorized key is expired
+	ErrKeyExpired = errors.New("authorized key is expired")
+	// ErrKeyNotYetValid is returned when the matched authorized key is not valid yet
+	ErrKeyNotYetValid = errors.New("authorized key is not valid yet")
+	// ErrKeyOutsideTimeWindow is returned when the matched authorized key is used outside of its time window
+	ErrKeyOutsideTimeWindow = errors.New("authorized key is outside of its time window")
+	// ErrClientRejected is returned when the client is not allowed by the matched authorized key
+	ErrClientRejected = errors.New("client is rejected")
+	// ErrLockedOut is returned when the user or the client IP is locked out after repeated failures
+	ErrLockedOut = errors.New("locked out")
+	// ErrProtocolDenied is returned when the user cannot log in over the protocol of the request
+	ErrProtocolDenied = errors.New("protocol is denied")
+	// ErrPolicyDenied is returned when the access policy denies the user by groups or the user type
+	ErrPolicyDenied = errors.New("denied by access policy")
+)
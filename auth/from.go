@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	hostResolveTimeout time.Duration = 5 * time.Second
+)
+
+// HostResolver resolves client addresses to hostnames for hostname patterns in from= option.
+// *net.Resolver satisfies this interface.
+type HostResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+var (
+	hostResolver      HostResolver = net.DefaultResolver
+	hostResolverMutex sync.RWMutex
+)
+
+// SetHostResolver sets a resolver used to match hostname patterns in from= option
+func SetHostResolver(resolver HostResolver) {
+	hostResolverMutex.Lock()
+	defer hostResolverMutex.Unlock()
+
+	hostResolver = resolver
+}
+
+func getHostResolver() HostResolver {
+	hostResolverMutex.RLock()
+	defer hostResolverMutex.RUnlock()
+
+	return hostResolver
+}
+
+// matchFromPatterns checks if the client is allowed by from= patterns, following sshd semantics.
+// A pattern is an address, a CIDR, or a glob with * and ? matched against the whole address or hostname.
+// A pattern prefixed with ! rejects the client when it matches, regardless of other patterns.
+func matchFromPatterns(ctx context.Context, clientIP string, patterns []string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		log.Debugf("failed to parse client address '%s'", clientIP)
+		return false
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		// IPv4-mapped IPv6 address
+		ip = ip4
+	}
+
+	var hostnames []string
+	hostnamesResolved := false
+
+	allowed := false
+	for _, pattern := range patterns {
+		negated := false
+		if strings.HasPrefix(pattern, "!") {
+			negated = true
+			pattern = pattern[1:]
+		}
+
+		if len(pattern) == 0 {
+			continue
+		}
+
+		matched := matchAddressPattern(ip, pattern)
+		if !matched && isHostnamePattern(pattern) {
+			if !hostnamesResolved {
+				hostnames = resolveHostnames(ctx, ip)
+				hostnamesResolved = true
+			}
+
+			matched = matchHostnamePattern(hostnames, pattern)
+		}
+
+		if matched {
+			if negated {
+				log.Debugf("client %s is rejected because it matches to !%s", clientIP, pattern)
+				return false
+			}
+			allowed = true
+		}
+	}
+
+	return allowed
+}
+
+// matchAddressPattern matches an address to an address, CIDR or glob pattern
+func matchAddressPattern(ip net.IP, pattern string) bool {
+	if strings.Contains(pattern, "/") {
+		_, patternNet, err := net.ParseCIDR(pattern)
+		if err != nil {
+			log.Debugf("failed to parse CIDR pattern '%s'", pattern)
+			return false
+		}
+
+		return patternNet.Contains(ip)
+	}
+
+	if strings.ContainsAny(pattern, "*?") {
+		return matchGlob(ip.String(), strings.ToLower(pattern))
+	}
+
+	patternIP := net.ParseIP(pattern)
+	if patternIP == nil {
+		return false
+	}
+
+	return patternIP.Equal(ip)
+}
+
+// isHostnamePattern checks if the pattern can match hostnames rather than only addresses
+func isHostnamePattern(pattern string) bool {
+	if strings.ContainsAny(pattern, ":/") {
+		return false
+	}
+
+	return strings.IndexFunc(pattern, func(r rune) bool {
+		return !(r >= '0' && r <= '9') && r != '.' && r != '*' && r != '?'
+	}) >= 0
+}
+
+// matchHostnamePattern matches hostnames to a glob pattern case-insensitively
+func matchHostnamePattern(hostnames []string, pattern string) bool {
+	pattern = strings.ToLower(pattern)
+	for _, hostname := range hostnames {
+		if matchGlob(hostname, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHostnames returns hostnames of the address that resolve back to the address
+func resolveHostnames(ctx context.Context, ip net.IP) []string {
+	resolver := getHostResolver()
+	if resolver == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hostResolveTimeout)
+	defer cancel()
+
+	names, err := resolver.LookupAddr(ctx, ip.String())
+	if err != nil {
+		log.Debugf("failed to resolve hostnames of %s - %s", ip.String(), err.Error())
+		return nil
+	}
+
+	hostnames := []string{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+		// reverse mapping can be forged, check that the name maps back to the address
+		addrs, err := resolver.LookupHost(ctx, name)
+		if err != nil {
+			log.Debugf("failed to resolve addresses of %s - %s", name, err.Error())
+			continue
+		}
+
+		for _, addr := range addrs {
+			if addrIP := net.ParseIP(addr); addrIP != nil && addrIP.Equal(ip) {
+				hostnames = append(hostnames, name)
+				break
+			}
+		}
+	}
+
+	return hostnames
+}
+
+// matchGlob matches a whole string to a pattern with * and ? wildcards
+// It backtracks only to the last star, as OpenSSH's match_pattern, so it takes linear time per star
+func matchGlob(s string, pattern string) bool {
+	sIndex := 0
+	patternIndex := 0
+
+	// positions to resume from when a match after the last star fails
+	starIndex := -1
+	starMatchIndex := 0
+
+	for sIndex < len(s) {
+		switch {
+		case patternIndex < len(pattern) && pattern[patternIndex] == '*':
+			starIndex = patternIndex
+			starMatchIndex = sIndex
+			patternIndex++
+		case patternIndex < len(pattern) && (pattern[patternIndex] == '?' || pattern[patternIndex] == s[sIndex]):
+			sIndex++
+			patternIndex++
+		case starIndex >= 0:
+			// let the last star match one more character
+			starMatchIndex++
+			sIndex = starMatchIndex
+			patternIndex = starIndex + 1
+		default:
+			return false
+		}
+	}
+
+	// trailing stars match empty
+	for patternIndex < len(pattern) && pattern[patternIndex] == '*' {
+		patternIndex++
+	}
+
+	return patternIndex == len(pattern)
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeHostResolver resolves names of a static table
+type fakeHostResolver struct {
+	names map[string][]string
+	addrs map[string][]string
+}
+
+func (resolver *fakeHostResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if names, ok := resolver.names[addr]; ok {
+		return names, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (resolver *fakeHostResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := resolver.addrs[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestMatchFromPatterns(t *testing.T) {
+	SetHostResolver(&fakeHostResolver{
+		names: map[string][]string{
+			"10.1.2.3":  {"ws1.lab.example.org."},
+			"10.9.9.9":  {"forged.lab.example.org."},
+			"10.1.2.34": {"ws2.lab.example.org."},
+		},
+		addrs: map[string][]string{
+			"ws1.lab.example.org":    {"10.1.2.3"},
+			"forged.lab.example.org": {"10.0.0.1"},
+		},
+	})
+	t.Cleanup(func() {
+		SetHostResolver(net.DefaultResolver)
+	})
+
+	tests := []struct {
+		name     string
+		clientIP string
+		patterns []string
+		want     bool
+	}{
+		{"address", "10.1.2.3", []string{"10.1.2.3"}, true},
+		{"address does not match a substring", "110.1.2.34", []string{"10.1.2.3"}, false},
+		{"glob matches the whole address", "110.1.2.34", []string{"10.1.2.*"}, false},
+		{"glob", "10.1.2.34", []string{"10.1.2.*"}, true},
+		{"question mark matches a single char", "10.1.2.34", []string{"10.1.2.?"}, false},
+		{"cidr", "10.200.0.1", []string{"10.0.0.0/8"}, true},
+		{"negated pattern wins", "10.1.2.3", []string{"10.0.0.0/8", "!10.1.2.3"}, false},
+		{"negated pattern wins regardless of order", "10.1.2.3", []string{"!10.1.2.3", "10.0.0.0/8"}, false},
+		{"only negated patterns", "10.1.2.4", []string{"!10.1.2.3"}, false},
+		{"ipv4-mapped ipv6 address", "::ffff:10.1.2.3", []string{"10.0.0.0/8"}, true},
+		{"ipv6 cidr", "2001:db8::1", []string{"2001:db8::/32"}, true},
+		{"ipv6 glob", "2001:db8::1", []string{"2001:db8:*"}, true},
+		{"ipv6 glob not matching", "2001:db9::1", []string{"2001:db8:*"}, false},
+		{"hostname", "10.1.2.3", []string{"*.lab.example.org"}, true},
+		{"hostname case-insensitively", "10.1.2.3", []string{"*.EXAMPLE.org"}, true},
+		{"negated hostname", "10.1.2.3", []string{"*.example.org", "!ws1.*"}, false},
+		{"forged reverse mapping", "10.9.9.9", []string{"*.lab.example.org"}, false},
+		{"name not resolving back", "10.1.2.34", []string{"ws2.lab.example.org"}, false},
+		{"no reverse mapping", "10.5.5.5", []string{"*.example.org"}, false},
+		{"invalid client address", "not-an-ip", []string{"*"}, false},
+		{"invalid cidr", "10.1.2.3", []string{"10.0.0.0/99"}, false},
+		{"no patterns", "10.1.2.3", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchFromPatterns(context.Background(), test.clientIP, test.patterns); got != test.want {
+				t.Errorf("matchFromPatterns(%q, %q) = %t, want %t", test.clientIP, test.patterns, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		s       string
+		pattern string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "*", true},
+		{"", "?", false},
+		{"host", "host", true},
+		{"host", "hos", false},
+		{"host", "h?st", true},
+		{"host", "h*", true},
+		{"host", "*t", true},
+		{"host", "*x*", false},
+		{"host.example.com", "*.example.com", true},
+		{"example.com", "*.example.com", false},
+		{"a.b.example.com", "*.example.com", true},
+		{"abcabd", "*abd", true},
+		{"abcabc", "a*c?bc", true},
+		{"abc", "a**c", true},
+		{"ab", "a*b*", true},
+		{"ab", "a*?*?", false},
+	}
+
+	for _, test := range tests {
+		if got := matchGlob(test.s, test.pattern); got != test.want {
+			t.Errorf("matchGlob(%q, %q) = %t, want %t", test.s, test.pattern, got, test.want)
+		}
+	}
+
+	// many stars must not backtrack exponentially
+	s := strings.Repeat("a", 100)
+	pattern := strings.Repeat("*a", 50) + "b"
+
+	done := make(chan bool)
+	go func() {
+		done <- matchGlob(s, pattern)
+	}()
+
+	select {
+	case matched := <-done:
+		if matched {
+			t.Errorf("matchGlob(%q, %q) = true", s, pattern)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("matchGlob does not finish for a pattern of many stars")
+	}
+}
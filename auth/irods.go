@@ -2,9 +2,11 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -23,17 +25,17 @@ const (
 	authRequestTimeout    time.Duration = 30 * time.Second
 )
 
-func makeIRODSHomePath(config *commons.Config) string {
-	return fmt.Sprintf("/%s/home/%s", config.IRODSZone, config.SFTPGoAuthdUsername)
+func makeIRODSHomePath(config *commons.Config, username string) string {
+	return fmt.Sprintf("/%s/home/%s", config.IRODSZone, username)
 }
 
-func makeSSHPath(config *commons.Config) string {
-	homePath := makeIRODSHomePath(config)
+func makeSSHPath(config *commons.Config, username string) string {
+	homePath := makeIRODSHomePath(config, username)
 	return path.Join(homePath, ".ssh")
 }
 
-func makeSSHAuthorizedKeysPath(config *commons.Config) string {
-	sshPath := makeSSHPath(config)
+func makeSSHAuthorizedKeysPath(config *commons.Config, username string) string {
+	sshPath := makeSSHPath(config, username)
 	return path.Join(sshPath, authorizedKeyFilename)
 }
 
@@ -55,6 +57,8 @@ func makeIRODSAccount(config *commons.Config) (*irodsclient_types.IRODSAccount,
 			log.Debugf("failed to create iRODS account for auth")
 			return nil, err
 		}
+
+		irodsAccount.PamTTL = config.IRODSPAMTTL
 	default:
 		log.Debugf("unknown authentication scheme %s", config.IRODSAuthScheme)
 		return nil, fmt.Errorf("unknown authentication scheme %s", config.IRODSAuthScheme)
@@ -67,30 +71,90 @@ func makeIRODSAccount(config *commons.Config) (*irodsclient_types.IRODSAccount,
 
 		if require == irodsclient_types.CSNegotiationPolicyRequestSSL || len(config.IRODSSSLCACertificatePath) > 0 {
 			// SSL
-			sslConf := irodsclient_types.IRODSSSLConfig{
-				CACertificatePath:       config.IRODSSSLCACertificatePath,
-				EncryptionKeySize:       config.IRODSSSLKeySize,
-				EncryptionAlgorithm:     config.IRODSSSLAlgorithm,
-				EncryptionSaltSize:      config.IRODSSSLSaltSize,
-				EncryptionNumHashRounds: config.IRODSSSLHashRounds,
-				VerifyServer:            irodsclient_types.SSLVerifyServerNone,
-			}
-
-			irodsAccount.SetSSLConfiguration(&sslConf)
+			irodsAccount.SetSSLConfiguration(makeIRODSSSLConfig(config))
 		}
 	}
 
 	return irodsAccount, nil
 }
 
-func makeIRODSConnectionConfig() *irodsclient_conn.IRODSConnectionConfig {
+func makeIRODSSSLConfig(config *commons.Config) *irodsclient_types.IRODSSSLConfig {
+	// the iRODS client verifies certificates only in hostname mode, cert mode is rejected in config validation
+	verifyServer, _ := irodsclient_types.GetSSLVerifyServer(strings.ToLower(config.IRODSSSLVerifyServer))
+	if verifyServer == irodsclient_types.SSLVerifyServerNone {
+		log.Debugf("iRODS server certificate is not verified")
+	}
+
+	return &irodsclient_types.IRODSSSLConfig{
+		CACertificatePath:       config.IRODSSSLCACertificatePath,
+		EncryptionKeySize:       config.IRODSSSLKeySize,
+		EncryptionAlgorithm:     config.IRODSSSLAlgorithm,
+		EncryptionSaltSize:      config.IRODSSSLSaltSize,
+		EncryptionNumHashRounds: config.IRODSSSLHashRounds,
+		VerifyServer:            verifyServer,
+		ServerName:              config.IRODSSSLServerName,
+	}
+}
+
+// makeIRODSAccountForSessionToken returns an account logging in with a PAM session token, as SFTPGo does
+func makeIRODSAccountForSessionToken(config *commons.Config, sessionToken string) (*irodsclient_types.IRODSAccount, error) {
+	tokenConfig := *config
+	tokenConfig.IRODSAuthScheme = "native"
+	tokenConfig.SFTPGoAuthdPassword = sessionToken
+	return makeIRODSAccount(&tokenConfig)
+}
+
+// makeIRODSConnectionConfig returns a connection config with timeouts not exceeding the deadline of ctx,
+// as the iRODS client does not take a context
+func makeIRODSConnectionConfig(ctx context.Context) *irodsclient_conn.IRODSConnectionConfig {
+	timeout := authRequestTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+
 	return &irodsclient_conn.IRODSConnectionConfig{
-		OperationTimeout:     authRequestTimeout,
-		LongOperationTimeout: authRequestTimeout,
+		ConnectTimeout:       timeout,
+		OperationTimeout:     timeout,
+		LongOperationTimeout: timeout,
 		ApplicationName:      applicationName,
 	}
 }
 
+// connectIRODS connects to iRODS using the account, trying iRODS hosts in order until one is reachable
+// It returns the host connected
+func connectIRODS(ctx context.Context, config *commons.Config, irodsAccount *irodsclient_types.IRODSAccount) (*irodsclient_conn.IRODSConnection, string, error) {
+	var lastErr error
+	for _, host := range config.GetIRODSHosts() {
+		err := ctx.Err()
+		if err != nil {
+			return nil, "", err
+		}
+
+		irodsAccount.Host = host
+		irodsConnectionConfig := makeIRODSConnectionConfig(ctx)
+
+		irodsConn, err := irodsclient_conn.NewIRODSConnection(irodsAccount, irodsConnectionConfig)
+		if err != nil {
+			return nil, "", err
+		}
+
+		err = irodsConn.Connect()
+		if err == nil {
+			return irodsConn, host, nil
+		}
+
+		if irodsclient_types.IsAuthError(err) {
+			// other hosts would reject the same credentials
+			return nil, "", err
+		}
+
+		log.Debugf("failed to connect to iRODS host '%s': %v", host, err)
+		lastErr = err
+	}
+
+	return nil, "", lastErr
+}
+
 func makeIRODSAccountForProxy(config *commons.Config) (*irodsclient_types.IRODSAccount, error) {
 	var irodsAccount *irodsclient_types.IRODSAccount
 	var err error
@@ -124,16 +188,7 @@ func makeIRODSAccountForProxy(config *commons.Config) (*irodsclient_types.IRODSA
 
 		if require == irodsclient_types.CSNegotiationPolicyRequestSSL || len(config.IRODSSSLCACertificatePath) > 0 {
 			// SSL
-			sslConf := irodsclient_types.IRODSSSLConfig{
-				CACertificatePath:       config.IRODSSSLCACertificatePath,
-				EncryptionKeySize:       config.IRODSSSLKeySize,
-				EncryptionAlgorithm:     config.IRODSSSLAlgorithm,
-				EncryptionSaltSize:      config.IRODSSSLSaltSize,
-				EncryptionNumHashRounds: config.IRODSSSLHashRounds,
-				VerifyServer:            irodsclient_types.SSLVerifyServerNone,
-			}
-
-			irodsAccount.SetSSLConfiguration(&sslConf)
+			irodsAccount.SetSSLConfiguration(makeIRODSSSLConfig(config))
 		}
 	}
 
@@ -141,126 +196,333 @@ func makeIRODSAccountForProxy(config *commons.Config) (*irodsclient_types.IRODSA
 }
 
 // AuthViaPassword authenticate a user via password
-func AuthViaPassword(config *commons.Config) (bool, error) {
+// It returns a PAM token issued by iRODS if PAM session token is enabled, and the iRODS host that accepted the password
+// The .ssh dir is created on the login, so cached logins and one-time codes do not need another login.
+// Without proxy, the login connection is handed to the catalog for its queries.
+func AuthViaPassword(ctx context.Context, config *commons.Config, catalog *IRODSCatalogClient) (bool, string, string, error) {
+	cache := newPasswordAuthCache(config)
+	var cacheKey *authCacheKey
+	if cache != nil {
+		cacheKey = cache.deriveKey(config.SFTPGoAuthdUsername, config.SFTPGoAuthdPassword, config.SFTPGoAuthdIP)
+
+		sessionToken, host, ok := getCachedPasswordAuth(config, cache, cacheKey)
+		if ok {
+			log.Debugf("authenticated a user '%s' using cached password auth", config.SFTPGoAuthdUsername)
+			if catalog != nil && !config.IsProxyAuth() {
+				// the catalog logs in with the token, not with the password via PAM again
+				catalog.setSessionToken(sessionToken)
+			}
+			return true, sessionToken, host, nil
+		}
+	}
+
 	irodsAccount, err := makeIRODSAccount(config)
 	if err != nil {
-		return false, err
+		return false, "", "", err
 	}
 
-	irodsConnectionConfig := makeIRODSConnectionConfig()
-
-	irodsConn, err := irodsclient_conn.NewIRODSConnection(irodsAccount, irodsConnectionConfig)
+	irodsConn, host, err := connectIRODS(ctx, config, irodsAccount)
 	if err != nil {
-		return false, err
+		// auth fail
+		if irodsclient_types.IsAuthError(err) {
+			if cache != nil {
+				// password may have been changed
+				cache.invalidateUser(config.SFTPGoAuthdUsername)
+			}
+			return false, "", "", fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+		}
+		return false, "", "", err
+	}
+
+	if catalog != nil && !config.IsProxyAuth() {
+		// the catalog closes it
+		catalog.setConnection(irodsConn, host)
+	} else {
+		defer irodsConn.Disconnect()
+	}
+
+	sessionToken := ""
+	if config.IRODSPAMSessionToken && !config.IsAnonymousUser() {
+		sessionToken = irodsConn.GetPAMToken()
+		if len(sessionToken) == 0 {
+			return false, "", "", fmt.Errorf("iRODS did not issue a PAM token for the user '%s'", config.SFTPGoAuthdUsername)
+		}
+	}
+
+	if !config.IsAnonymousUser() {
+		err = createSSHDir(config, irodsConn)
+		if err != nil {
+			return false, "", "", err
+		}
 	}
 
-	err = irodsConn.Connect()
+	if cache != nil {
+		putCachedPasswordAuth(config, cache, cacheKey, sessionToken, host)
+	}
+
+	return true, sessionToken, host, nil
+}
+
+// newPasswordAuthCache returns the auth cache for password auth, nil if the cache is disabled or the password must not be cached.
+// One-time codes must not be accepted again, so keyboard interactive auth and passwords having a one-time code are not cached.
+// PAM passwords are cached only if IRODSPAMOTPSeparator is given, otherwise one-time codes cannot be told from passwords,
+// and only with proxy or PAM session token, which catalog queries of cached logins use instead of another PAM login.
+func newPasswordAuthCache(config *commons.Config) *authCache {
+	if config.IsKeyboardInteractiveAuth() {
+		return nil
+	}
+
+	if config.IsPAMAuth() {
+		if !config.IsProxyAuth() && !config.IRODSPAMSessionToken {
+			log.Debugf("not caching PAM password auth of the user '%s', catalog queries would log in via PAM without proxy or session token", config.SFTPGoAuthdUsername)
+			return nil
+		}
+
+		if len(config.IRODSPAMOTPSeparator) == 0 {
+			log.Debugf("not caching PAM password auth of the user '%s' without one-time code separator", config.SFTPGoAuthdUsername)
+			return nil
+		}
+
+		if strings.Contains(config.SFTPGoAuthdPassword, config.IRODSPAMOTPSeparator) {
+			log.Debugf("not caching password auth of the user '%s' having a one-time code", config.SFTPGoAuthdUsername)
+			return nil
+		}
+	}
+
+	return newAuthCache(config)
+}
+
+func getCachedPasswordAuth(config *commons.Config, cache *authCache, cacheKey *authCacheKey) (string, string, bool) {
+	entry, ok := cache.get(cacheKey)
+	if !ok {
+		return "", "", false
+	}
+
+	if !slices.Contains(config.GetIRODSHosts(), entry.Host) {
+		// cached before hosts are changed
+		return "", "", false
+	}
+
+	if len(entry.EncryptedSessionToken) == 0 {
+		if config.IRODSPAMSessionToken && !config.IsAnonymousUser() {
+			// cached before session token is enabled
+			return "", "", false
+		}
+		return "", entry.Host, true
+	}
+
+	sessionToken, err := cache.openSessionToken(cacheKey, entry.EncryptedSessionToken)
 	if err != nil {
-		// auth fail
-		return false, err
+		log.WithError(err).Debugf("failed to decrypt cached session token for the user '%s'", config.SFTPGoAuthdUsername)
+		return "", "", false
+	}
+	return sessionToken, entry.Host, true
+}
+
+func putCachedPasswordAuth(config *commons.Config, cache *authCache, cacheKey *authCacheKey, sessionToken string, host string) {
+	entry := authCacheEntry{
+		Host: host,
+	}
+	if len(sessionToken) > 0 {
+		encryptedSessionToken, err := cache.sealSessionToken(cacheKey, sessionToken)
+		if err != nil {
+			log.WithError(err).Warnf("failed to encrypt session token for the user '%s'", config.SFTPGoAuthdUsername)
+			return
+		}
+		entry.EncryptedSessionToken = encryptedSessionToken
 	}
 
-	defer irodsConn.Disconnect()
-	return true, nil
+	cache.put(cacheKey, &entry)
 }
 
 // AuthViaPublicKey authenticate a user via public key
-func AuthViaPublicKey(config *commons.Config) (bool, []string, error) {
+// It returns the matched key and the iRODS host that authorized keys are read from
+func AuthViaPublicKey(ctx context.Context, config *commons.Config) (bool, *AuthorizedKey, string, error) {
 	log.Debugf("authenticating a user '%s'", config.SFTPGoAuthdUsername)
 
 	userKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(config.SFTPGoAuthdPublickey))
 	if err != nil {
 		log.Debugf("failed to parse public-key for a user '%s'", config.SFTPGoAuthdUsername)
-		return false, nil, err
+		return false, nil, "", err
 	}
 
 	// login using proxy (admin) account
 	irodsAccount, err := makeIRODSAccountForProxy(config)
 	if err != nil {
-		return false, nil, err
+		return false, nil, "", err
 	}
 
-	irodsConnectionConfig := makeIRODSConnectionConfig()
-
-	irodsConn, err := irodsclient_conn.NewIRODSConnection(irodsAccount, irodsConnectionConfig)
-	if err != nil {
-		return false, nil, err
-	}
-	err = irodsConn.Connect()
+	irodsConn, host, err := connectIRODS(ctx, config, irodsAccount)
 	if err != nil {
 		// auth fail
 		log.Debugf("failed to login via iRODS proxy user account")
-		return false, nil, err
+		return false, nil, "", err
 	}
 
 	defer irodsConn.Disconnect()
 
-	authorizedKeys, err := readAuthorizedKeys(config, irodsConn)
+	keySources, err := makeKeySources(config, irodsConn)
 	if err != nil {
-		// auth fail
-		return false, nil, err
+		return false, nil, "", err
+	}
+
+	cache := newAuthCache(config)
+
+	loggedIn := false
+	var authorizedKey *AuthorizedKey
+	authorizedKeysVersion := ""
+
+	var cacheKey *authCacheKey
+	if cache != nil {
+		cacheKey = cache.deriveKey(config.SFTPGoAuthdUsername, config.SFTPGoAuthdPublickey, config.SFTPGoAuthdIP)
+		loggedIn, authorizedKey, authorizedKeysVersion = getCachedPublicKeyAuth(ctx, config, cache, cacheKey, keySources, userKey)
+	}
+
+	if !loggedIn {
+		authorizedKey, authorizedKeysVersion, err = findAuthorizedKey(ctx, keySources, userKey, config.SFTPGoAuthdUsername, config.SFTPGoAuthdIP)
+		if err != nil {
+			// auth fail
+			return false, nil, "", err
+		}
+
+		loggedIn = authorizedKey != nil
 	}
 
-	loggedIn, options := checkAuthorizedKey(authorizedKeys, userKey)
 	if loggedIn {
-		log.Debugf("checking options - %v", options)
+		options := authorizedKey.Options
+		log.Debugf("checking options of line %d - %+v", authorizedKey.LineNumber, options)
+		keyTimeLocation := config.GetPublicKeyTimeLocation()
+
 		// expiry
-		if IsKeyExpired(options) {
-			return false, options, fmt.Errorf("public key access for the user '%s' is expired", config.SFTPGoAuthdUsername)
+		if IsKeyExpired(options, keyTimeLocation) {
+			return false, authorizedKey, "", fmt.Errorf("public key access for the user '%s' is expired: %w", config.SFTPGoAuthdUsername, ErrKeyExpired)
+		}
+
+		// activation
+		if IsKeyNotYetValid(options, keyTimeLocation) {
+			return false, authorizedKey, "", fmt.Errorf("public key access for the user '%s' is not valid yet: %w", config.SFTPGoAuthdUsername, ErrKeyNotYetValid)
+		}
+
+		if IsKeyOutsideTimeWindow(options, keyTimeLocation) {
+			return false, authorizedKey, "", fmt.Errorf("public key access for the user '%s' is outside of the time window: %w", config.SFTPGoAuthdUsername, ErrKeyOutsideTimeWindow)
 		}
 
 		// reject by client whilte-list
-		if IsClientRejected(config.SFTPGoAuthdIP, options) {
-			return false, options, fmt.Errorf("public key access for the user '%s' is rejected", config.SFTPGoAuthdUsername)
+		if IsClientRejected(ctx, config.SFTPGoAuthdIP, options) {
+			return false, authorizedKey, "", fmt.Errorf("public key access for the user '%s' is rejected: %w", config.SFTPGoAuthdUsername, ErrClientRejected)
+		}
+
+		// reject by protocols
+		err = CheckProtocol(config, GetAllowedProtocols(config, options))
+		if err != nil {
+			return false, authorizedKey, "", err
+		}
+
+		if cache != nil {
+			cache.put(cacheKey, &authCacheEntry{
+				KeySource:             authorizedKey.Source,
+				AuthorizedKeyLine:     authorizedKey.Line,
+				LineNumber:            authorizedKey.LineNumber,
+				SameTypeHomeKeys:      authorizedKey.SameTypeHomeKeys,
+				AuthorizedKeysVersion: authorizedKeysVersion,
+			})
 		}
 
 		// auth success
 		log.Debugf("authenticated a user '%s'", config.SFTPGoAuthdUsername)
-		return true, options, nil
+		return true, authorizedKey, host, nil
 	}
 
 	// auth fail
 	log.Debugf("unable to authenticate the user '%s' using a public key", config.SFTPGoAuthdUsername)
-	return false, nil, fmt.Errorf("unable to find matching authorized public key for the user '%s'", config.SFTPGoAuthdUsername)
+	return false, nil, "", fmt.Errorf("unable to find matching authorized public key for the user '%s': %w", config.SFTPGoAuthdUsername, ErrKeyNotFound)
+}
+
+// getCachedPublicKeyAuth checks the user key against the cached line, if key sources are not changed since it is cached
+func getCachedPublicKeyAuth(ctx context.Context, config *commons.Config, cache *authCache, cacheKey *authCacheKey, keySources []KeySource, userKey ssh.PublicKey) (bool, *AuthorizedKey, string) {
+	entry, ok := cache.get(cacheKey)
+	if !ok {
+		return false, nil, ""
+	}
+
+	authorizedKeysVersion, err := statKeySources(ctx, keySources, entry.KeySource, config.SFTPGoAuthdUsername)
+	if err != nil || authorizedKeysVersion != entry.AuthorizedKeysVersion {
+		log.Debugf("authorized keys of the user '%s' are changed, ignoring cached public key auth", config.SFTPGoAuthdUsername)
+		cache.remove(cacheKey)
+		return false, nil, ""
+	}
+
+	// check again as certificates may be expired
+	loggedIn, authorizedKey := checkAuthorizedKey([]byte(entry.AuthorizedKeyLine), userKey, config.SFTPGoAuthdUsername, config.SFTPGoAuthdIP)
+	if !loggedIn {
+		return false, nil, ""
+	}
+
+	authorizedKey.Source = entry.KeySource
+	authorizedKey.LineNumber = entry.LineNumber
+	authorizedKey.SameTypeHomeKeys = entry.SameTypeHomeKeys
+
+	log.Debugf("matched cached public key auth for the user '%s'", config.SFTPGoAuthdUsername)
+	return true, authorizedKey, authorizedKeysVersion
+}
+
+// statAuthorizedKeys returns a version of authorized_keys, that changes when the file is modified
+func statAuthorizedKeys(config *commons.Config, irodsConn *irodsclient_conn.IRODSConnection, username string) (string, error) {
+	sshAuthorizedKeysPath := makeSSHAuthorizedKeysPath(config, username)
+	sshAuthorizedKeysDataObject, err := irodsclient_fs.GetDataObjectMasterReplica(irodsConn, sshAuthorizedKeysPath)
+	if err != nil {
+		return "", err
+	}
+
+	return getAuthorizedKeysVersion(sshAuthorizedKeysDataObject), nil
+}
+
+func getAuthorizedKeysVersion(dataObject *irodsclient_types.IRODSDataObject) string {
+	modifyTime := time.Time{}
+	if len(dataObject.Replicas) > 0 {
+		modifyTime = dataObject.Replicas[0].ModifyTime
+	}
+
+	return fmt.Sprintf("%d:%d:%s", dataObject.ID, dataObject.Size, modifyTime.UTC().Format(time.RFC3339Nano))
 }
 
 // readAuthorizedKeys returns content of authorized_keys
-func readAuthorizedKeys(config *commons.Config, irodsConn *irodsclient_conn.IRODSConnection) ([]byte, error) {
+func readAuthorizedKeys(config *commons.Config, irodsConn *irodsclient_conn.IRODSConnection, username string) ([]byte, string, error) {
 	// check .ssh dir
-	sshPath := makeSSHPath(config)
+	sshPath := makeSSHPath(config, username)
 
 	log.Debugf("checking .ssh dir '%s'", sshPath)
 	sshCollection, err := irodsclient_fs.GetCollection(irodsConn, sshPath)
 	if err != nil {
 		log.Debugf(".ssh dir not exist'%s'", sshPath)
-		return nil, err
+		return nil, "", err
 	}
 
 	if sshCollection.ID <= 0 {
 		// collection not exist
 		log.Debugf(".ssh dir not exist'%s'", sshPath)
-		return nil, err
+		return nil, "", err
 	}
 
 	// get .ssh/authorized_keys file
-	sshAuthorizedKeysPath := makeSSHAuthorizedKeysPath(config)
+	sshAuthorizedKeysPath := makeSSHAuthorizedKeysPath(config, username)
 	log.Debugf("checking .ssh/authorized_keys file '%s'", sshAuthorizedKeysPath)
 	sshAuthorizedKeysDataObject, err := irodsclient_fs.GetDataObjectMasterReplica(irodsConn, sshAuthorizedKeysPath)
 	if err != nil {
 		log.Debugf(".ssh/authorized_keys file not exist '%s'", sshAuthorizedKeysPath)
-		return nil, err
+		return nil, "", err
 	}
 
 	if sshAuthorizedKeysDataObject.ID <= 0 {
 		// authorized keys not exist
 		log.Debugf(".ssh/authorized_keys file not exist '%s'", sshAuthorizedKeysPath)
-		return nil, err
+		return nil, "", err
 	}
 
 	fileHandle, _, err := irodsclient_fs.OpenDataObject(irodsConn, sshAuthorizedKeysPath, "", "r", nil)
 	if err != nil {
 		log.Debugf("failed to open .ssh/authorized_keys file '%s'", sshAuthorizedKeysPath)
-		return nil, err
+		return nil, "", err
 	}
 
 	defer irodsclient_fs.CloseDataObject(irodsConn, fileHandle)
@@ -271,7 +533,7 @@ func readAuthorizedKeys(config *commons.Config, irodsConn *irodsclient_conn.IROD
 		readLen, err := irodsclient_fs.ReadDataObject(irodsConn, fileHandle, readBuffer)
 		if err != nil && err != io.EOF {
 			log.Debugf("failed to read .ssh/authorized_keys file '%s'", sshAuthorizedKeysPath)
-			return nil, err
+			return nil, "", err
 		}
 
 		authorizedKeysBuffer.Write(readBuffer[:readLen])
@@ -280,47 +542,16 @@ func readAuthorizedKeys(config *commons.Config, irodsConn *irodsclient_conn.IROD
 		}
 	}
 
-	return authorizedKeysBuffer.Bytes(), nil
+	return authorizedKeysBuffer.Bytes(), getAuthorizedKeysVersion(sshAuthorizedKeysDataObject), nil
 }
 
-func CreateSshDir(config *commons.Config) error {
-	sshPath := makeSSHPath(config)
+// createSSHDir creates .ssh dir of the user on the connection, if not exist
+func createSSHDir(config *commons.Config, irodsConn *irodsclient_conn.IRODSConnection) error {
+	sshPath := makeSSHPath(config, config.SFTPGoAuthdUsername)
 
 	log.Debugf("creating .ssh dir '%s'", sshPath)
 
-	var irodsAccount *irodsclient_types.IRODSAccount
-	var err error
-
-	if config.IsProxyAuth() {
-		// login using proxy (admin) account
-		irodsAccount, err = makeIRODSAccountForProxy(config)
-		if err != nil {
-			return err
-		}
-	} else {
-		// login
-		irodsAccount, err = makeIRODSAccount(config)
-		if err != nil {
-			return err
-		}
-	}
-
-	irodsConnectionConfig := makeIRODSConnectionConfig()
-
-	irodsConn, err := irodsclient_conn.NewIRODSConnection(irodsAccount, irodsConnectionConfig)
-	if err != nil {
-		return err
-	}
-	err = irodsConn.Connect()
-	if err != nil {
-		// auth fail
-		log.Debugf("failed to login via iRODS proxy user account")
-		return err
-	}
-
-	defer irodsConn.Disconnect()
-
-	err = irodsclient_fs.CreateCollection(irodsConn, sshPath, true)
+	err := irodsclient_fs.CreateCollection(irodsConn, sshPath, true)
 	if err != nil {
 		log.Debugf("failed to create .ssh dir")
 		return err
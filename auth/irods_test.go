@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+)
+
+func TestMakeIRODSConnectionConfig(t *testing.T) {
+	connectionConfig := makeIRODSConnectionConfig(context.Background())
+	if connectionConfig.ConnectTimeout != authRequestTimeout || connectionConfig.OperationTimeout != authRequestTimeout {
+		t.Errorf("timeouts = %s, %s, want %s", connectionConfig.ConnectTimeout, connectionConfig.OperationTimeout, authRequestTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	connectionConfig = makeIRODSConnectionConfig(ctx)
+	if connectionConfig.ConnectTimeout > time.Second || connectionConfig.OperationTimeout > time.Second || connectionConfig.LongOperationTimeout > time.Second {
+		t.Errorf("timeouts exceed the deadline: %+v", connectionConfig)
+	}
+}
+
+func TestConnectIRODSCanceled(t *testing.T) {
+	config := &commons.Config{
+		IRODSHost: "irods.example.com",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := connectIRODS(ctx, config, &irodsclient_types.IRODSAccount{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("connect is not stopped by the context: %v", err)
+	}
+}
+
+func TestMakeIRODSSSLConfig(t *testing.T) {
+	tests := []struct {
+		name              string
+		verifyServer      string
+		serverName        string
+		wantSkipVerify    bool
+		wantTLSServerName string
+	}{
+		{"no verification", "none", "", true, "irods.example.com"},
+		{"hostname verification", "hostname", "", false, "irods.example.com"},
+		{"hostname verification in upper case", "HOSTNAME", "", false, "irods.example.com"},
+		{"server name override", "hostname", "irods.internal", false, "irods.internal"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &commons.Config{
+				IRODSSSLVerifyServer: test.verifyServer,
+				IRODSSSLServerName:   test.serverName,
+			}
+
+			sslConfig := makeIRODSSSLConfig(config)
+			if sslConfig.ServerName != test.serverName {
+				t.Errorf("server name = %q, want %q", sslConfig.ServerName, test.serverName)
+			}
+
+			// the iRODS client makes the TLS config of its connection this way
+			tlsConfig, err := sslConfig.GetTLSConfig("irods.example.com", true)
+			if err != nil {
+				t.Fatalf("failed to make a TLS config: %v", err)
+			}
+			if tlsConfig.InsecureSkipVerify != test.wantSkipVerify {
+				t.Errorf("skip verify = %t, want %t", tlsConfig.InsecureSkipVerify, test.wantSkipVerify)
+			}
+			if tlsConfig.ServerName != test.wantTLSServerName {
+				t.Errorf("SNI server name = %q, want %q", tlsConfig.ServerName, test.wantTLSServerName)
+			}
+		})
+	}
+}
+
+func TestMakeIRODSAccountSSL(t *testing.T) {
+	config := &commons.Config{
+		IRODSHost:                 "irods.example.com",
+		IRODSPort:                 1247,
+		IRODSZone:                 "zone",
+		IRODSAuthScheme:           "pam",
+		IRODSRequireCSNegotiation: true,
+		IRODSCSNegotiationPolicy:  "CS_NEG_REQUIRE",
+		IRODSSSLVerifyServer:      "hostname",
+		IRODSSSLServerName:        "irods.internal",
+		IRODSProxyUsername:        "proxy",
+		IRODSProxyPassword:        "proxy_password",
+		SFTPGoAuthdUsername:       "user1",
+		SFTPGoAuthdPassword:       "password",
+	}
+
+	for name, makeAccount := range map[string]func(*commons.Config) (*irodsclient_types.IRODSAccount, error){
+		"user":  makeIRODSAccount,
+		"proxy": makeIRODSAccountForProxy,
+	} {
+		t.Run(name, func(t *testing.T) {
+			account, err := makeAccount(config)
+			if err != nil {
+				t.Fatalf("failed to make an account: %v", err)
+			}
+			if account.SSLConfiguration == nil {
+				t.Fatal("SSL is not configured")
+			}
+			if account.SSLConfiguration.VerifyServer != irodsclient_types.SSLVerifyServerHostname || account.SSLConfiguration.ServerName != "irods.internal" {
+				t.Errorf("SSL config = %+v", account.SSLConfiguration)
+			}
+		})
+	}
+}
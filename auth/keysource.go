@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+
+	irodsclient_conn "github.com/cyverse/go-irodsclient/irods/connection"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// public key source names
+const (
+	KeySourceIRODSFile = "file"
+	KeySourceIRODSAVU  = "avu"
+	KeySourceLocalFile = "local"
+	KeySourceHTTP      = "http"
+)
+
+// KeySource provides authorized_keys lines of users
+type KeySource interface {
+	// Name returns the name of the source, used in logs and cached auth results
+	Name() string
+	// ReadAuthorizedKeys returns authorized_keys lines of the user, and a version that changes when they change
+	ReadAuthorizedKeys(ctx context.Context, username string) ([]byte, string, error)
+	// StatAuthorizedKeys returns the version of authorized_keys lines of the user, the same as ReadAuthorizedKeys returns
+	StatAuthorizedKeys(ctx context.Context, username string) (string, error)
+}
+
+// makeKeySources returns key sources in the configured order
+// iRODS sources use the connection, that must be logged in with a proxy account
+func makeKeySources(config *commons.Config, irodsConn *irodsclient_conn.IRODSConnection) ([]KeySource, error) {
+	keySources := []KeySource{}
+	for _, source := range config.PublicKeySources {
+		switch strings.ToLower(source) {
+		case KeySourceIRODSFile:
+			keySources = append(keySources, newIRODSFileKeySource(config, irodsConn))
+		case KeySourceIRODSAVU:
+			keySources = append(keySources, newIRODSAVUKeySource(config, irodsConn))
+		case KeySourceLocalFile:
+			keySources = append(keySources, NewLocalFileKeySource(config.PublicKeyLocalDir))
+		case KeySourceHTTP:
+			keySources = append(keySources, NewHTTPKeySource(config.PublicKeyHTTPURL, nil))
+		default:
+			return nil, fmt.Errorf("unknown public key source %s", source)
+		}
+	}
+	return keySources, nil
+}
+
+// findAuthorizedKey checks the user key against key sources in order, and returns the first match with versions of the sources checked
+// A source that fails to read is skipped, the error is returned only if no source is read
+// A canceled context stops the search, so the next source is not read.
+func findAuthorizedKey(ctx context.Context, keySources []KeySource, userKey ssh.PublicKey, username string, clientIP string) (*AuthorizedKey, string, error) {
+	versions := []string{}
+	read := false
+
+	var lastErr error
+	for _, keySource := range keySources {
+		err := ctx.Err()
+		if err != nil {
+			return nil, "", err
+		}
+
+		authorizedKeys, version, err := keySource.ReadAuthorizedKeys(ctx, username)
+		if err != nil {
+			log.Debugf("failed to read authorized keys of the user '%s' from %s: %v", username, keySource.Name(), err)
+			lastErr = err
+			versions = append(versions, makeKeySourceVersion(keySource, ""))
+			continue
+		}
+
+		read = true
+		versions = append(versions, makeKeySourceVersion(keySource, version))
+
+		loggedIn, authorizedKey := checkAuthorizedKey(authorizedKeys, userKey, username, clientIP)
+		if loggedIn {
+			authorizedKey.Source = keySource.Name()
+			log.Debugf("found a matching authorized key of the user '%s' in %s line %d", username, authorizedKey.Source, authorizedKey.LineNumber)
+			return authorizedKey, strings.Join(versions, ";"), nil
+		}
+	}
+
+	if !read && lastErr != nil {
+		return nil, "", lastErr
+	}
+	return nil, "", nil
+}
+
+// statKeySources returns versions of key sources up to the named one, the same as findAuthorizedKey returns for a match in the source
+func statKeySources(ctx context.Context, keySources []KeySource, sourceName string, username string) (string, error) {
+	versions := []string{}
+	for _, keySource := range keySources {
+		err := ctx.Err()
+		if err != nil {
+			return "", err
+		}
+
+		version, err := keySource.StatAuthorizedKeys(ctx, username)
+		if err != nil {
+			version = ""
+		}
+
+		versions = append(versions, makeKeySourceVersion(keySource, version))
+
+		if keySource.Name() == sourceName {
+			if err != nil {
+				return "", err
+			}
+			return strings.Join(versions, ";"), nil
+		}
+	}
+
+	return "", fmt.Errorf("public key source %s is not configured", sourceName)
+}
+
+func makeKeySourceVersion(keySource KeySource, version string) string {
+	return fmt.Sprintf("%s=%s", keySource.Name(), version)
+}
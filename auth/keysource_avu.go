@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+
+	irodsclient_conn "github.com/cyverse/go-irodsclient/irods/connection"
+	irodsclient_fs "github.com/cyverse/go-irodsclient/irods/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// irodsAVUKeySource reads public key AVUs of the iRODS user
+// An AVU value is an authorized_keys line, and options in the units are merged into its options
+type irodsAVUKeySource struct {
+	config    *commons.Config
+	irodsConn *irodsclient_conn.IRODSConnection
+}
+
+func newIRODSAVUKeySource(config *commons.Config, irodsConn *irodsclient_conn.IRODSConnection) *irodsAVUKeySource {
+	return &irodsAVUKeySource{
+		config:    config,
+		irodsConn: irodsConn,
+	}
+}
+
+func (source *irodsAVUKeySource) Name() string {
+	return KeySourceIRODSAVU
+}
+
+func (source *irodsAVUKeySource) ReadAuthorizedKeys(ctx context.Context, username string) ([]byte, string, error) {
+	log.Debugf("checking public key AVUs '%s' of the user '%s'", source.config.PublicKeyAVUName, username)
+
+	metas, err := irodsclient_fs.ListUserMeta(source.irodsConn, username, source.config.IRODSZone)
+	if err != nil {
+		log.Debugf("failed to list AVUs of the user '%s'", username)
+		return nil, "", err
+	}
+
+	authorizedKeys := makeAVUAuthorizedKeys(metas, source.config.PublicKeyAVUName)
+
+	hash := sha256.Sum256(authorizedKeys)
+	return authorizedKeys, hex.EncodeToString(hash[:]), nil
+}
+
+// makeAVUAuthorizedKeys returns authorized_keys lines of the AVUs named avuName, in the order of AVU IDs
+// AVUs having multiple lines are skipped
+func makeAVUAuthorizedKeys(metas []*irodsclient_types.IRODSMeta, avuName string) []byte {
+	// keep the order stable, for line numbers and the version
+	sort.Slice(metas, func(i int, j int) bool {
+		return metas[i].AVUID < metas[j].AVUID
+	})
+
+	lines := []string{}
+	for _, meta := range metas {
+		if meta.Name != avuName {
+			continue
+		}
+
+		value := strings.TrimSpace(meta.Value)
+		units := strings.TrimSpace(meta.Units)
+		if strings.ContainsAny(value, "\r\n") || strings.ContainsAny(units, "\r\n") {
+			// options in the units would not apply to following lines
+			log.Debugf("skipping public key AVU %d having multiple lines", meta.AVUID)
+			continue
+		}
+
+		if len(units) > 0 {
+			value = mergeAVUKeyOptions(units, value)
+		}
+
+		lines = append(lines, value)
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// mergeAVUKeyOptions prepends options in the units to the value
+// Options of the value are joined with a comma, as a space would end the options and break the key
+func mergeAVUKeyOptions(units string, value string) string {
+	_, _, options, _, err := ssh.ParseAuthorizedKey([]byte(value))
+	if err == nil && len(options) > 0 {
+		return units + "," + value
+	}
+
+	return units + " " + value
+}
+
+// StatAuthorizedKeys reads AVUs again, as they have no cheaper way to check changes
+func (source *irodsAVUKeySource) StatAuthorizedKeys(ctx context.Context, username string) (string, error) {
+	_, version, err := source.ReadAuthorizedKeys(ctx, username)
+	return version, err
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"testing"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestMakeAVUAuthorizedKeys(t *testing.T) {
+	const key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBeQ2I2+6o8s3PbFhV5BfTSCWBm6PJE5YO0JrrKUBrzh user1"
+
+	tests := []struct {
+		name  string
+		metas []*irodsclient_types.IRODSMeta
+		want  string
+	}{
+		{"no AVUs", nil, ""},
+		{"key", []*irodsclient_types.IRODSMeta{{AVUID: 1, Name: "ssh-key", Value: key}}, key},
+		{"options in the value", []*irodsclient_types.IRODSMeta{{AVUID: 1, Name: "ssh-key", Value: "readonly " + key}}, "readonly " + key},
+		{"options in the units", []*irodsclient_types.IRODSMeta{{AVUID: 1, Name: "ssh-key", Value: " " + key + " ", Units: " readonly "}}, "readonly " + key},
+		{"options in the units and the value", []*irodsclient_types.IRODSMeta{{AVUID: 1, Name: "ssh-key", Value: "from=\"192.0.2.1\" " + key, Units: "no-pty"}}, "no-pty,from=\"192.0.2.1\" " + key},
+		{"other AVU names", []*irodsclient_types.IRODSMeta{{AVUID: 1, Name: "other", Value: key}}, ""},
+		{"multi-line value", []*irodsclient_types.IRODSMeta{{AVUID: 1, Name: "ssh-key", Value: key + "\n" + key}}, ""},
+		{"multi-line units", []*irodsclient_types.IRODSMeta{{AVUID: 1, Name: "ssh-key", Value: key, Units: "readonly\r\nfrom=\"*\""}}, ""},
+		{
+			"order of AVU IDs",
+			[]*irodsclient_types.IRODSMeta{
+				{AVUID: 3, Name: "ssh-key", Value: key, Units: "name=\"third\""},
+				{AVUID: 1, Name: "ssh-key", Value: key, Units: "name=\"first\""},
+				{AVUID: 2, Name: "ssh-key", Value: key + "\n" + key},
+			},
+			"name=\"first\" " + key + "\nname=\"third\" " + key,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(makeAVUAuthorizedKeys(test.metas, "ssh-key"))
+			if got != test.want {
+				t.Errorf("authorized keys = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMakeAVUAuthorizedKeysOptions(t *testing.T) {
+	userKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBeQ2I2+6o8s3PbFhV5BfTSCWBm6PJE5YO0JrrKUBrzh user1"))
+	if err != nil {
+		t.Fatalf("failed to parse the user key: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		meta *irodsclient_types.IRODSMeta
+	}{
+		{"value", &irodsclient_types.IRODSMeta{AVUID: 1, Name: "ssh-key", Value: "name=\"laptop\",readonly " + string(ssh.MarshalAuthorizedKey(userKey))}},
+		{"units", &irodsclient_types.IRODSMeta{AVUID: 1, Name: "ssh-key", Value: string(ssh.MarshalAuthorizedKey(userKey)), Units: "name=\"laptop\",readonly"}},
+		{"units and value", &irodsclient_types.IRODSMeta{AVUID: 1, Name: "ssh-key", Value: "name=\"laptop\" " + string(ssh.MarshalAuthorizedKey(userKey)), Units: "readonly"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorizedKeys := makeAVUAuthorizedKeys([]*irodsclient_types.IRODSMeta{test.meta}, "ssh-key")
+
+			ok, authorizedKey := checkAuthorizedKey(authorizedKeys, userKey, "user1", "192.0.2.1")
+			if !ok {
+				t.Fatalf("key is not found in %q", authorizedKeys)
+			}
+			if authorizedKey.Options.Name != "laptop" || !authorizedKey.Options.ReadOnly {
+				t.Errorf("options = %+v, want name and readonly", authorizedKey.Options)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	httpKeySourceUsernamePlaceholder string = "{username}"
+	httpKeySourceMaxResponseLength   int64  = 1024 * 1024 // 1MB
+)
+
+// HTTPKeySource reads authorized_keys lines of users from an HTTP endpoint
+// The endpoint returns authorized_keys text with status 200, or status 404 if the user has no keys
+type HTTPKeySource struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPKeySource returns a HTTPKeySource requesting the URL, with {username} in the URL replaced by the escaped user name
+// If client is nil, a client with the auth request timeout is used
+func NewHTTPKeySource(url string, client *http.Client) *HTTPKeySource {
+	if client == nil {
+		client = &http.Client{
+			Timeout: authRequestTimeout,
+		}
+	}
+
+	return &HTTPKeySource{
+		url:    url,
+		client: client,
+	}
+}
+
+// Name returns the name of the source
+func (source *HTTPKeySource) Name() string {
+	return KeySourceHTTP
+}
+
+func (source *HTTPKeySource) getURL(username string) string {
+	// escape for both of path and query
+	escapedUsername := strings.ReplaceAll(url.QueryEscape(username), "+", "%20")
+	return strings.ReplaceAll(source.url, httpKeySourceUsernamePlaceholder, escapedUsername)
+}
+
+// ReadAuthorizedKeys returns authorized_keys lines from the endpoint, versioned by their hash
+func (source *HTTPKeySource) ReadAuthorizedKeys(ctx context.Context, username string) ([]byte, string, error) {
+	requestURL := source.getURL(username)
+	log.Debugf("requesting authorized keys of the user '%s' to '%s'", username, requestURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to make a request for authorized keys: %w", err)
+	}
+
+	resp, err := source.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to request authorized keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	authorizedKeys := []byte{}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		authorizedKeys, err = io.ReadAll(io.LimitReader(resp.Body, httpKeySourceMaxResponseLength+1))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read authorized keys response: %w", err)
+		}
+
+		if int64(len(authorizedKeys)) > httpKeySourceMaxResponseLength {
+			return nil, "", fmt.Errorf("authorized keys response is longer than %d bytes", httpKeySourceMaxResponseLength)
+		}
+	case http.StatusNotFound:
+		// no keys
+	default:
+		return nil, "", fmt.Errorf("failed to request authorized keys, HTTP status %s", resp.Status)
+	}
+
+	hash := sha256.Sum256(authorizedKeys)
+	return authorizedKeys, hex.EncodeToString(hash[:]), nil
+}
+
+// StatAuthorizedKeys requests authorized_keys lines again, as the endpoint has no cheaper way to check changes
+func (source *HTTPKeySource) StatAuthorizedKeys(ctx context.Context, username string) (string, error) {
+	_, version, err := source.ReadAuthorizedKeys(ctx, username)
+	return version, err
+}
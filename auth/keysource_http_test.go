@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPKeySourceReadAuthorizedKeys(t *testing.T) {
+	const authorizedKeys = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBeQ2I2+6o8s3PbFhV5BfTSCWBm6PJE5YO0JrrKUBrzh user1\n"
+
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantKeys    string
+		wantErr     bool
+		errContains string
+	}{
+		{"keys", http.StatusOK, authorizedKeys, authorizedKeys, false, ""},
+		{"no keys", http.StatusNotFound, "not found", "", false, ""},
+		{"max length", http.StatusOK, strings.Repeat("#", int(httpKeySourceMaxResponseLength)), strings.Repeat("#", int(httpKeySourceMaxResponseLength)), false, ""},
+		{"oversized body", http.StatusOK, strings.Repeat("#", int(httpKeySourceMaxResponseLength)+1), "", true, "longer than"},
+		{"forbidden", http.StatusForbidden, authorizedKeys, "", true, "403"},
+		{"server error", http.StatusInternalServerError, authorizedKeys, "", true, "500"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestPath := ""
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestPath = r.URL.EscapedPath()
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			source := NewHTTPKeySource(server.URL+"/keys/{username}", server.Client())
+			keys, version, err := source.ReadAuthorizedKeys(context.Background(), "user 1")
+			if requestPath != "/keys/user%201" {
+				t.Errorf("request path = %q", requestPath)
+			}
+
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), test.errContains) {
+					t.Fatalf("err = %v, want an error containing %q", err, test.errContains)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to read authorized keys: %v", err)
+			}
+			if string(keys) != test.wantKeys {
+				t.Errorf("keys = %q, want %q", keys, test.wantKeys)
+			}
+			if len(version) == 0 {
+				t.Errorf("version is empty")
+			}
+
+			statVersion, err := source.StatAuthorizedKeys(context.Background(), "user 1")
+			if err != nil || statVersion != version {
+				t.Errorf("stat version = %q, err = %v, want %q", statVersion, err, version)
+			}
+		})
+	}
+}
+
+func TestHTTPKeySourceVersionChanges(t *testing.T) {
+	body := "ssh-ed25519 AAAA key1\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	source := NewHTTPKeySource(server.URL+"/{username}", server.Client())
+	_, version, err := source.ReadAuthorizedKeys(context.Background(), "user1")
+	if err != nil {
+		t.Fatalf("failed to read authorized keys: %v", err)
+	}
+
+	body = "ssh-ed25519 AAAA key2\n"
+	newVersion, err := source.StatAuthorizedKeys(context.Background(), "user1")
+	if err != nil {
+		t.Fatalf("failed to stat authorized keys: %v", err)
+	}
+	if newVersion == version {
+		t.Errorf("version does not change when keys are changed")
+	}
+}
+
+func TestHTTPKeySourceTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := server.Client()
+	client.Timeout = 100 * time.Millisecond
+
+	source := NewHTTPKeySource(server.URL+"/{username}", client)
+
+	start := time.Now()
+	_, _, err := source.ReadAuthorizedKeys(context.Background(), "user1")
+	if err == nil {
+		t.Fatal("request does not time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request took %s", elapsed)
+	}
+}
+
+func TestHTTPKeySourceCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	source := NewHTTPKeySource(server.URL+"/{username}", server.Client())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, _, err := source.ReadAuthorizedKeys(ctx, "user1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("request is not stopped by the context: %v", err)
+	}
+}
+
+func TestNewHTTPKeySourceDefaultClient(t *testing.T) {
+	source := NewHTTPKeySource("https://keys.example.com/{username}", nil)
+	if source.client == nil || source.client.Timeout != authRequestTimeout {
+		t.Errorf("default client does not have the auth request timeout")
+	}
+}
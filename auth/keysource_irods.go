@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+
+	irodsclient_conn "github.com/cyverse/go-irodsclient/irods/connection"
+)
+
+// irodsFileKeySource reads .ssh/authorized_keys in user's iRODS home
+type irodsFileKeySource struct {
+	config    *commons.Config
+	irodsConn *irodsclient_conn.IRODSConnection
+}
+
+func newIRODSFileKeySource(config *commons.Config, irodsConn *irodsclient_conn.IRODSConnection) *irodsFileKeySource {
+	return &irodsFileKeySource{
+		config:    config,
+		irodsConn: irodsConn,
+	}
+}
+
+func (source *irodsFileKeySource) Name() string {
+	return KeySourceIRODSFile
+}
+
+func (source *irodsFileKeySource) ReadAuthorizedKeys(ctx context.Context, username string) ([]byte, string, error) {
+	return readAuthorizedKeys(source.config, source.irodsConn, username)
+}
+
+func (source *irodsFileKeySource) StatAuthorizedKeys(ctx context.Context, username string) (string, error) {
+	return statAuthorizedKeys(source.config, source.irodsConn, username)
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LocalFileKeySource reads authorized_keys files named by user names in a local dir
+type LocalFileKeySource struct {
+	dir string
+}
+
+// NewLocalFileKeySource returns a LocalFileKeySource reading files in the dir
+func NewLocalFileKeySource(dir string) *LocalFileKeySource {
+	return &LocalFileKeySource{
+		dir: dir,
+	}
+}
+
+// Name returns the name of the source
+func (source *LocalFileKeySource) Name() string {
+	return KeySourceLocalFile
+}
+
+func (source *LocalFileKeySource) getPath(username string) (string, error) {
+	if len(username) == 0 || username == "." || username == ".." || strings.ContainsAny(username, "/\\\x00") {
+		return "", fmt.Errorf("user name %q cannot be used as a file name", username)
+	}
+	return filepath.Join(source.dir, username), nil
+}
+
+// ReadAuthorizedKeys returns content of the user's file, empty if the file does not exist
+func (source *LocalFileKeySource) ReadAuthorizedKeys(ctx context.Context, username string) ([]byte, string, error) {
+	keysPath, err := source.getPath(username)
+	if err != nil {
+		return nil, "", err
+	}
+
+	log.Debugf("checking local authorized keys file '%s'", keysPath)
+
+	// stat first, not to miss changes after reading
+	version, err := source.StatAuthorizedKeys(ctx, username)
+	if err != nil {
+		return nil, "", err
+	}
+
+	authorizedKeys, err := os.ReadFile(keysPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []byte{}, version, nil
+		}
+		return nil, "", err
+	}
+
+	return authorizedKeys, version, nil
+}
+
+// StatAuthorizedKeys returns a version of the user's file, that changes when the file is modified
+func (source *LocalFileKeySource) StatAuthorizedKeys(ctx context.Context, username string) (string, error) {
+	keysPath, err := source.getPath(username)
+	if err != nil {
+		return "", err
+	}
+
+	fileInfo, err := os.Stat(keysPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "-", nil
+		}
+		return "", err
+	}
+
+	return fmt.Sprintf("%d:%s", fileInfo.Size(), fileInfo.ModTime().UTC().Format(time.RFC3339Nano)), nil
+}
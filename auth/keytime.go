@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keyTimeLayoutDateTime string = "2006-01-02 15:04:05"
+	minutesPerDay         int    = 24 * 60
+)
+
+// keyTimeLayouts are layouts of times in key options by length, other lengths use keyTimeLayoutDateTime
+var keyTimeLayouts = map[int]string{
+	8:  "20060102",
+	12: "200601021504",
+	14: "20060102150405",
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseKeyTime parses a time in key options, such as expiry-time and valid-after.
+// It accepts RFC3339, and YYYYMMDD, YYYYMMDDHHMM, YYYYMMDDHHMMSS or "YYYY-MM-DD HH:MM:SS"
+// followed by an optional Z for UTC or an IANA zone name after a space, e.g. "20261231 America/Phoenix".
+// Times without a zone are in the location.
+func ParseKeyTime(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	if idx := strings.LastIndexByte(value, ' '); idx >= 0 {
+		zoneName := value[idx+1:]
+		// the last field of "YYYY-MM-DD HH:MM:SS" is not a zone
+		if !strings.Contains(zoneName, ":") {
+			zoneLocation, err := time.LoadLocation(zoneName)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("unknown time zone %q", zoneName)
+			}
+
+			value = strings.TrimSpace(value[:idx])
+			location = zoneLocation
+		}
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		value = strings.TrimSuffix(value, "Z")
+		location = time.UTC
+	}
+
+	layout, ok := keyTimeLayouts[len(value)]
+	if !ok {
+		layout = keyTimeLayoutDateTime
+	}
+
+	t, err = time.ParseInLocation(layout, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return t, nil
+}
+
+// timeWindow is a weekly time window, such as "Mon-Fri 08:00-18:00 America/Phoenix"
+type timeWindow struct {
+	days [7]bool
+	// start and end are minutes of a day, end is earlier than start if the window spans midnight
+	start    int
+	end      int
+	allDay   bool
+	location *time.Location
+}
+
+// parseTimeWindow parses a time window of days, a time range and a zone name, in the order.
+// Days are weekday names and ranges separated by commas, such as "Mon-Fri" or "Mon,Wed,Fri".
+// The time range is "HH:MM-HH:MM", that spans midnight if the end is earlier than the start.
+// Days or the time range can be omitted for every day or all day. Windows without a zone are in the location.
+func parseTimeWindow(value string, location *time.Location) (*timeWindow, error) {
+	window := &timeWindow{
+		allDay:   true,
+		location: location,
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("time window is empty")
+	}
+
+	hasDays := false
+	for idx, field := range fields {
+		switch {
+		case idx == 0 && isWeekdaySpec(field):
+			err := window.parseDays(field)
+			if err != nil {
+				return nil, err
+			}
+			hasDays = true
+		case strings.Contains(field, ":") && window.allDay:
+			err := window.parseTimeRange(field)
+			if err != nil {
+				return nil, err
+			}
+		case idx == len(fields)-1 && (hasDays || !window.allDay):
+			zoneLocation, err := time.LoadLocation(field)
+			if err != nil {
+				return nil, fmt.Errorf("unknown time zone %q", field)
+			}
+			window.location = zoneLocation
+		default:
+			return nil, fmt.Errorf("invalid time window %q", value)
+		}
+	}
+
+	if !hasDays {
+		for day := range window.days {
+			window.days[day] = true
+		}
+	}
+
+	return window, nil
+}
+
+func isWeekdaySpec(value string) bool {
+	day, _, _ := strings.Cut(value, ",")
+	day, _, _ = strings.Cut(day, "-")
+	_, ok := weekdayNames[strings.ToLower(day)]
+	return ok
+}
+
+func (window *timeWindow) parseDays(value string) error {
+	for _, dayRange := range strings.Split(value, ",") {
+		startName, endName, isRange := strings.Cut(dayRange, "-")
+		if !isRange {
+			endName = startName
+		}
+
+		start, ok := weekdayNames[strings.ToLower(startName)]
+		if !ok {
+			return fmt.Errorf("invalid weekday %q", startName)
+		}
+
+		end, ok := weekdayNames[strings.ToLower(endName)]
+		if !ok {
+			return fmt.Errorf("invalid weekday %q", endName)
+		}
+
+		// ranges may wrap around the week, such as Fri-Mon
+		for day := start; ; day = (day + 1) % 7 {
+			window.days[day] = true
+			if day == end {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (window *timeWindow) parseTimeRange(value string) error {
+	startValue, endValue, ok := strings.Cut(value, "-")
+	if !ok {
+		return fmt.Errorf("invalid time range %q", value)
+	}
+
+	start, err := parseMinuteOfDay(startValue)
+	if err != nil {
+		return err
+	}
+
+	end, err := parseMinuteOfDay(endValue)
+	if err != nil {
+		return err
+	}
+
+	if start == end {
+		return fmt.Errorf("time range %q is empty", value)
+	}
+
+	window.start = start
+	window.end = end
+	window.allDay = false
+	return nil
+}
+
+// parseMinuteOfDay parses "HH:MM" into minutes of a day, "24:00" is the end of a day
+func parseMinuteOfDay(value string) (int, error) {
+	hourValue, minuteValue, ok := strings.Cut(value, ":")
+	if !ok || len(hourValue) == 0 || len(hourValue) > 2 || len(minuteValue) != 2 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+
+	hour, err := strconv.Atoi(hourValue)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+
+	minute, err := strconv.Atoi(minuteValue)
+	if err != nil || minute < 0 || minute >= 60 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+
+	minuteOfDay := hour*60 + minute
+	if hour < 0 || minuteOfDay > minutesPerDay {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return minuteOfDay, nil
+}
+
+// contains checks if the time is in the window
+func (window *timeWindow) contains(t time.Time) bool {
+	t = t.In(window.location)
+	day := t.Weekday()
+
+	if window.allDay {
+		return window.days[day]
+	}
+
+	minuteOfDay := t.Hour()*60 + t.Minute()
+	if window.start < window.end {
+		return window.days[day] && window.start <= minuteOfDay && minuteOfDay < window.end
+	}
+
+	// spans midnight, the part after midnight belongs to the previous day
+	previousDay := (day + 6) % 7
+	return (window.days[day] && minuteOfDay >= window.start) || (window.days[previousDay] && minuteOfDay < window.end)
+}
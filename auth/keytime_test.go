@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseKeyTime(t *testing.T) {
+	phoenix, err := time.LoadLocation("America/Phoenix")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"20261231", time.Date(2026, 12, 31, 0, 0, 0, 0, phoenix), false},
+		{"20261231Z", time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), false},
+		{"202612311530Z", time.Date(2026, 12, 31, 15, 30, 0, 0, time.UTC), false},
+		{"20261231153045", time.Date(2026, 12, 31, 15, 30, 45, 0, phoenix), false},
+		{"2026-12-31T10:00:00+02:00", time.Date(2026, 12, 31, 8, 0, 0, 0, time.UTC), false},
+		{"20261231 UTC", time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), false},
+		{"2026-12-31 10:00:00", time.Date(2026, 12, 31, 10, 0, 0, 0, phoenix), false},
+		{"2026-12-31 10:00:00Z", time.Date(2026, 12, 31, 10, 0, 0, 0, time.UTC), false},
+		{"2026-12-31 10:00:00 UTC", time.Date(2026, 12, 31, 10, 0, 0, 0, time.UTC), false},
+		{" 20261231 ", time.Date(2026, 12, 31, 0, 0, 0, 0, phoenix), false},
+
+		{"2026", time.Time{}, true},
+		{"20261331", time.Time{}, true},
+		{"20261231 Nowhere/Zone", time.Time{}, true},
+		{"garbage", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseKeyTime(test.value, phoenix)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseKeyTime(%q) = %s, want an error", test.value, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to parse time: %v", err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("ParseKeyTime(%q) = %s, want %s", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	phoenix, err := time.LoadLocation("America/Phoenix")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	// 2026-10-16 is a Friday
+	friday := func(hour int, minute int) time.Time {
+		return time.Date(2026, 10, 16, hour, minute, 0, 0, time.UTC)
+	}
+	saturday := func(hour int, minute int) time.Time {
+		return time.Date(2026, 10, 17, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		window string
+		time   time.Time
+		want   bool
+	}{
+		{"in weekdays and hours", "Mon-Fri 08:00-18:00", friday(9, 0), true},
+		{"end is exclusive", "Mon-Fri 08:00-18:00", friday(18, 0), false},
+		{"start is inclusive", "Mon-Fri 08:00-18:00", friday(8, 0), true},
+		{"out of weekdays", "Mon-Fri 08:00-18:00", saturday(9, 0), false},
+		{"zone of the window", "Mon-Fri 08:00-18:00 America/Phoenix", friday(16, 0), true},
+		{"zone of the window out of hours", "Mon-Fri 08:00-18:00 America/Phoenix", friday(9, 0), false},
+		{"spans midnight before", "Fri 22:00-06:00", friday(23, 0), true},
+		{"spans midnight after", "Fri 22:00-06:00", saturday(5, 0), true},
+		{"spans midnight from the previous day", "Fri 22:00-06:00", friday(5, 0), false},
+		{"days only", "Sat,Sun", saturday(5, 0), true},
+		{"days only out of days", "Sat,Sun", friday(5, 0), false},
+		{"day range wrapping the week", "Fri-Mon", saturday(12, 0), true},
+		{"time range only", "08:00-18:00 UTC", saturday(9, 0), true},
+		{"end of day", "Fri 20:00-24:00", friday(23, 59), true},
+		{"lower-cased days", "fri", friday(12, 0), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window, err := parseTimeWindow(test.window, time.UTC)
+			if err != nil {
+				t.Fatalf("failed to parse time window: %v", err)
+			}
+			if got := window.contains(test.time); got != test.want {
+				t.Errorf("%q contains %s = %t, want %t", test.window, test.time, got, test.want)
+			}
+		})
+	}
+
+	invalidWindows := []string{
+		"",
+		"America/Phoenix",
+		"Mon-Fry",
+		"Mon 8-18",
+		"Mon 08:00-08:00",
+		"Mon 08:00-25:00",
+		"Mon 08:60-09:00",
+		"Mon 08:00-18:00 Bad/Zone",
+		"Mon 08:00-18:00 UTC extra",
+	}
+	for _, value := range invalidWindows {
+		t.Run("invalid "+value, func(t *testing.T) {
+			if _, err := parseTimeWindow(value, phoenix); err == nil {
+				t.Errorf("parseTimeWindow(%q) succeeded, want an error", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	lockoutLockFilename  string = "lock"
+	lockoutRecordSuffix  string = ".json"
+	lockoutMaxDoublings  int    = 30
+	lockoutFilePerm             = 0600
+	lockoutDirPermission        = 0700
+)
+
+// lockout record kinds
+const (
+	LockoutKindUser     = "user"
+	LockoutKindClientIP = "ip"
+)
+
+// Lockout is a failure record of a user or a client IP
+type Lockout struct {
+	// Kind is LockoutKindUser or LockoutKindClientIP
+	Kind        string    `json:"kind"`
+	Name        string    `json:"name"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	// LockedUntil is zero if not locked out
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// IsLocked checks if it is locked out at the time
+func (lockout *Lockout) IsLocked(now time.Time) bool {
+	return now.Before(lockout.LockedUntil)
+}
+
+// lockoutStore keeps lockout records in files, shared by concurrent hook processes.
+// Updates are serialized with an flock on a lock file in the dir.
+type lockoutStore struct {
+	dir string
+}
+
+func newLockoutStore(config *commons.Config) (*lockoutStore, error) {
+	err := os.MkdirAll(config.LockoutDir, lockoutDirPermission)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lockoutStore{
+		dir: config.LockoutDir,
+	}, nil
+}
+
+// withLock runs fn holding the lock, exclusive for updates
+func (store *lockoutStore) withLock(exclusive bool, fn func() error) error {
+	lockFile, err := os.OpenFile(filepath.Join(store.dir, lockoutLockFilename), os.O_CREATE|os.O_RDWR, lockoutFilePerm)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err = syscall.Flock(int(lockFile.Fd()), how)
+	if err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	return fn()
+}
+
+func (store *lockoutStore) getRecordPath(kind string, name string) string {
+	hash := sha256.Sum256([]byte(name))
+	return filepath.Join(store.dir, fmt.Sprintf("%s_%s%s", kind, hex.EncodeToString(hash[:16]), lockoutRecordSuffix))
+}
+
+// read returns the record, or a new record if not exist
+func (store *lockoutStore) read(kind string, name string) (*Lockout, error) {
+	lockout := Lockout{
+		Kind: kind,
+		Name: name,
+	}
+
+	data, err := os.ReadFile(store.getRecordPath(kind, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &lockout, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &lockout)
+	if err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+func (store *lockoutStore) write(lockout *Lockout) error {
+	data, err := json.Marshal(lockout)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(store.dir, "record.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(data)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), store.getRecordPath(lockout.Kind, lockout.Name))
+}
+
+func (store *lockoutStore) list() ([]*Lockout, error) {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	lockouts := []*Lockout{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), lockoutRecordSuffix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(store.dir, entry.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		lockout := Lockout{}
+		err = json.Unmarshal(data, &lockout)
+		if err != nil {
+			log.WithError(err).Warnf("failed to parse lockout record %q", entry.Name())
+			continue
+		}
+
+		lockouts = append(lockouts, &lockout)
+	}
+
+	sort.Slice(lockouts, func(i int, j int) bool {
+		if lockouts[i].Kind != lockouts[j].Kind {
+			return lockouts[i].Kind < lockouts[j].Kind
+		}
+		return lockouts[i].Name < lockouts[j].Name
+	})
+	return lockouts, nil
+}
+
+// getLockoutTargets returns kinds and names of records for the request
+func getLockoutTargets(config *commons.Config) [][2]string {
+	targets := [][2]string{
+		{LockoutKindUser, config.SFTPGoAuthdUsername},
+	}
+	if len(config.SFTPGoAuthdIP) > 0 {
+		targets = append(targets, [2]string{LockoutKindClientIP, config.SFTPGoAuthdIP})
+	}
+	return targets
+}
+
+// getLockoutDuration returns how long to lock out after the failures, doubling for each failure over the threshold
+func getLockoutDuration(config *commons.Config, failures int) time.Duration {
+	if failures < config.LockoutThreshold {
+		return 0
+	}
+
+	maxDuration := time.Duration(config.LockoutMaxDuration) * time.Second
+	duration := time.Duration(config.LockoutDuration) * time.Second
+
+	doublings := failures - config.LockoutThreshold
+	for i := 0; i < doublings && i < lockoutMaxDoublings && duration < maxDuration; i++ {
+		duration *= 2
+	}
+
+	if duration > maxDuration {
+		duration = maxDuration
+	}
+	return duration
+}
+
+// CheckLockout returns ErrLockedOut if the user or the client IP of the request is locked out
+func CheckLockout(config *commons.Config) error {
+	if !config.IsLockoutEnabled() {
+		return nil
+	}
+
+	store, err := newLockoutStore(config)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return store.withLock(false, func() error {
+		for _, target := range getLockoutTargets(config) {
+			lockout, err := store.read(target[0], target[1])
+			if err != nil {
+				return err
+			}
+
+			if lockout.IsLocked(now) {
+				return fmt.Errorf("%s '%s' is locked out until %s: %w", lockout.Kind, lockout.Name, lockout.LockedUntil.Format(time.RFC3339), ErrLockedOut)
+			}
+		}
+		return nil
+	})
+}
+
+// RecordAuthFailure counts a failure for the user and the client IP of the request
+func RecordAuthFailure(config *commons.Config) {
+	if !config.IsLockoutEnabled() {
+		return
+	}
+
+	store, err := newLockoutStore(config)
+	if err != nil {
+		log.WithError(err).Error("failed to open lockout records")
+		return
+	}
+
+	now := time.Now()
+	resetAfter := time.Duration(config.LockoutMaxDuration) * time.Second
+
+	err = store.withLock(true, func() error {
+		for _, target := range getLockoutTargets(config) {
+			lockout, err := store.read(target[0], target[1])
+			if err != nil {
+				return err
+			}
+
+			if !lockout.IsLocked(now) && now.Sub(lockout.LastFailure) > resetAfter {
+				// forget old failures
+				lockout.Failures = 0
+			}
+
+			lockout.Failures++
+			lockout.LastFailure = now
+
+			duration := getLockoutDuration(config, lockout.Failures)
+			if duration > 0 {
+				lockout.LockedUntil = now.Add(duration)
+				log.Warnf("%s '%s' is locked out for %s after %d failures", lockout.Kind, lockout.Name, duration, lockout.Failures)
+			}
+
+			err = store.write(lockout)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to record an auth failure")
+	}
+}
+
+// RecordAuthSuccess clears failures of the user of the request
+// Failures of the client IP are kept, not to let a valid account reset them
+func RecordAuthSuccess(config *commons.Config) {
+	if !config.IsLockoutEnabled() {
+		return
+	}
+
+	store, err := newLockoutStore(config)
+	if err != nil {
+		log.WithError(err).Error("failed to open lockout records")
+		return
+	}
+
+	err = store.withLock(true, func() error {
+		err := os.Remove(store.getRecordPath(LockoutKindUser, config.SFTPGoAuthdUsername))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to clear auth failures")
+	}
+}
+
+// ListLockouts returns all failure records
+func ListLockouts(config *commons.Config) ([]*Lockout, error) {
+	store, err := newLockoutStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var lockouts []*Lockout
+	err = store.withLock(false, func() error {
+		lockouts, err = store.list()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lockouts, nil
+}
+
+// ClearLockouts removes failure records of the kind and the name, all records if both are empty
+// It returns the number of removed records
+func ClearLockouts(config *commons.Config, kind string, name string) (int, error) {
+	store, err := newLockoutStore(config)
+	if err != nil {
+		return 0, err
+	}
+
+	cleared := 0
+	err = store.withLock(true, func() error {
+		lockouts, err := store.list()
+		if err != nil {
+			return err
+		}
+
+		for _, lockout := range lockouts {
+			if len(kind) > 0 && lockout.Kind != kind {
+				continue
+			}
+			if len(name) > 0 && lockout.Name != name {
+				continue
+			}
+
+			err = os.Remove(store.getRecordPath(lockout.Kind, lockout.Name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			cleared++
+		}
+		return nil
+	})
+	return cleared, err
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+func newTestLockoutConfig(t *testing.T) *commons.Config {
+	return &commons.Config{
+		LockoutDir:          t.TempDir(),
+		LockoutThreshold:    3,
+		LockoutDuration:     60,
+		LockoutMaxDuration:  3600,
+		SFTPGoAuthdUsername: "user1",
+		SFTPGoAuthdIP:       "192.0.2.1",
+	}
+}
+
+func TestGetLockoutDuration(t *testing.T) {
+	config := newTestLockoutConfig(t)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{8, 32 * time.Minute},
+		{9, time.Hour},
+		{100, time.Hour},
+		{1 << 20, time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := getLockoutDuration(config, test.failures); got != test.want {
+			t.Errorf("getLockoutDuration(%d) = %s, want %s", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	config := newTestLockoutConfig(t)
+
+	for i := 0; i < config.LockoutThreshold-1; i++ {
+		RecordAuthFailure(config)
+		if err := CheckLockout(config); err != nil {
+			t.Fatalf("locked out after %d failures: %v", i+1, err)
+		}
+	}
+
+	RecordAuthFailure(config)
+	if err := CheckLockout(config); !errors.Is(err, ErrLockedOut) {
+		t.Fatalf("not locked out at the threshold, err = %v", err)
+	}
+
+	// other users from the same client are locked out too
+	otherUser := *config
+	otherUser.SFTPGoAuthdUsername = "user2"
+	if err := CheckLockout(&otherUser); !errors.Is(err, ErrLockedOut) {
+		t.Errorf("other user from the client is not locked out, err = %v", err)
+	}
+
+	// the same user from other clients is locked out too
+	otherClient := *config
+	otherClient.SFTPGoAuthdIP = "192.0.2.2"
+	if err := CheckLockout(&otherClient); !errors.Is(err, ErrLockedOut) {
+		t.Errorf("user from other client is not locked out, err = %v", err)
+	}
+
+	lockouts, err := ListLockouts(config)
+	if err != nil || len(lockouts) != 2 {
+		t.Fatalf("lockouts = %v, err = %v", lockouts, err)
+	}
+	for _, lockout := range lockouts {
+		if lockout.Failures != config.LockoutThreshold || !lockout.IsLocked(time.Now()) {
+			t.Errorf("lockout = %+v", lockout)
+		}
+	}
+
+	cleared, err := ClearLockouts(config, LockoutKindUser, "user1")
+	if err != nil || cleared != 1 {
+		t.Fatalf("cleared = %d, err = %v", cleared, err)
+	}
+	if err := CheckLockout(config); !errors.Is(err, ErrLockedOut) {
+		t.Errorf("client is not locked out after clearing the user, err = %v", err)
+	}
+
+	cleared, err = ClearLockouts(config, "", "")
+	if err != nil || cleared != 1 {
+		t.Fatalf("cleared = %d, err = %v", cleared, err)
+	}
+	if err := CheckLockout(config); err != nil {
+		t.Errorf("locked out after clearing all, err = %v", err)
+	}
+}
+
+func TestRecordAuthSuccessKeepsClientFailures(t *testing.T) {
+	config := newTestLockoutConfig(t)
+
+	RecordAuthFailure(config)
+	RecordAuthFailure(config)
+	RecordAuthSuccess(config)
+
+	lockouts, err := ListLockouts(config)
+	if err != nil {
+		t.Fatalf("failed to list lockouts: %v", err)
+	}
+	if len(lockouts) != 1 || lockouts[0].Kind != LockoutKindClientIP || lockouts[0].Failures != 2 {
+		t.Errorf("lockouts = %+v, want failures of the client only", lockouts)
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	config := newTestLockoutConfig(t)
+	config.LockoutDir = ""
+
+	for i := 0; i < 10; i++ {
+		RecordAuthFailure(config)
+	}
+	if err := CheckLockout(config); err != nil {
+		t.Errorf("locked out while lockout is disabled, err = %v", err)
+	}
+}
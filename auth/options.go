@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+// KeyOptions is a set of options given to a key line in authorized_keys
+type KeyOptions struct {
+	// flags
+	CertAuthority     bool
+	Restrict          bool
+	NoPty             bool
+	NoPortForwarding  bool
+	NoAgentForwarding bool
+	NoX11Forwarding   bool
+	NoUserRC          bool
+	Pty               bool
+	PortForwarding    bool
+	AgentForwarding   bool
+	X11Forwarding     bool
+	UserRC            bool
+	NoTouchRequired   bool
+	VerifyRequired    bool
+	// ReadOnly limits SFTPGo permissions to list and download
+	ReadOnly bool
+
+	// single value options
+	Command    string
+	From       []string
+	Principals []string
+	ExpiryTime string
+	// ValidAfter is a time the key becomes valid, given as valid-after or not-before
+	ValidAfter string
+	// TimeWindow is a weekly time window the key can be used in
+	TimeWindow string
+	Tunnel     string
+	// Home is a home collection path for the key, absolute or relative to user's home
+	Home string
+	// Name is a name for the key, used in per-key SFTPGo username and virtual folder names
+	Name string
+	// Permissions are SFTPGo permissions granted on mounts for the key
+	Permissions []string
+	// Protocols are upper-cased SFTPGo protocols allowed for the key
+	Protocols []string
+
+	// multi value options
+	Environment  []string
+	PermitOpen   []string
+	PermitListen []string
+}
+
+// sftpgoPermissions are permissions that SFTPGo accepts
+var sftpgoPermissions = map[string]bool{
+	"*":               true,
+	"list":            true,
+	"download":        true,
+	"upload":          true,
+	"overwrite":       true,
+	"create_dirs":     true,
+	"rename":          true,
+	"rename_files":    true,
+	"rename_dirs":     true,
+	"delete":          true,
+	"delete_files":    true,
+	"delete_dirs":     true,
+	"create_symlinks": true,
+	"chmod":           true,
+	"chown":           true,
+	"chtimes":         true,
+	"copy":            true,
+}
+
+// readOnlyPermissions are permissions granted for readonly keys
+var readOnlyPermissions = []string{"list", "download"}
+
+// sftpgoPermissionParents map SFTPGo permissions to the permissions including them
+var sftpgoPermissionParents = map[string]string{
+	"rename_files": "rename",
+	"rename_dirs":  "rename",
+	"delete_files": "delete",
+	"delete_dirs":  "delete",
+}
+
+// GetReadOnlyPermissions returns SFTPGo permissions for reading only
+func GetReadOnlyPermissions() []string {
+	return slices.Clone(readOnlyPermissions)
+}
+
+// GetCollectionPermissions returns SFTPGo permissions for the access to a collection
+// Only listing is permitted without access, as SFTPGo requires permissions on every mount
+func GetCollectionPermissions(access CollectionAccess) []string {
+	switch access {
+	case CollectionAccessWrite:
+		return []string{"*"}
+	case CollectionAccessRead:
+		return GetReadOnlyPermissions()
+	default:
+		return []string{"list"}
+	}
+}
+
+// hasPermission checks if the permissions grant the permission
+func hasPermission(permissions []string, permission string) bool {
+	if slices.Contains(permissions, "*") || slices.Contains(permissions, permission) {
+		return true
+	}
+
+	parent, ok := sftpgoPermissionParents[permission]
+	return ok && slices.Contains(permissions, parent)
+}
+
+// intersectPermissions returns SFTPGo permissions granted by both
+func intersectPermissions(permissions []string, limits []string) []string {
+	if slices.Contains(permissions, "*") {
+		return slices.Clone(limits)
+	}
+	if slices.Contains(limits, "*") {
+		return slices.Clone(permissions)
+	}
+
+	intersection := []string{}
+	for _, permission := range permissions {
+		if hasPermission(limits, permission) {
+			intersection = append(intersection, permission)
+		}
+	}
+	for _, limit := range limits {
+		if !slices.Contains(intersection, limit) && hasPermission(permissions, limit) {
+			intersection = append(intersection, limit)
+		}
+	}
+	return intersection
+}
+
+type keyOptionKind int
+
+const (
+	keyOptionFlag keyOptionKind = iota
+	keyOptionSingleValue
+	keyOptionMultiValue
+)
+
+type keyOptionSpec struct {
+	kind  keyOptionKind
+	apply func(options *KeyOptions, value string)
+}
+
+var keyOptionSpecs = map[string]keyOptionSpec{
+	"cert-authority":      {keyOptionFlag, func(o *KeyOptions, v string) { o.CertAuthority = true }},
+	"restrict":            {keyOptionFlag, func(o *KeyOptions, v string) { o.Restrict = true }},
+	"no-pty":              {keyOptionFlag, func(o *KeyOptions, v string) { o.NoPty = true }},
+	"no-port-forwarding":  {keyOptionFlag, func(o *KeyOptions, v string) { o.NoPortForwarding = true }},
+	"no-agent-forwarding": {keyOptionFlag, func(o *KeyOptions, v string) { o.NoAgentForwarding = true }},
+	"no-x11-forwarding":   {keyOptionFlag, func(o *KeyOptions, v string) { o.NoX11Forwarding = true }},
+	"no-user-rc":          {keyOptionFlag, func(o *KeyOptions, v string) { o.NoUserRC = true }},
+	"pty":                 {keyOptionFlag, func(o *KeyOptions, v string) { o.Pty = true }},
+	"port-forwarding":     {keyOptionFlag, func(o *KeyOptions, v string) { o.PortForwarding = true }},
+	"agent-forwarding":    {keyOptionFlag, func(o *KeyOptions, v string) { o.AgentForwarding = true }},
+	"x11-forwarding":      {keyOptionFlag, func(o *KeyOptions, v string) { o.X11Forwarding = true }},
+	"user-rc":             {keyOptionFlag, func(o *KeyOptions, v string) { o.UserRC = true }},
+	"no-touch-required":   {keyOptionFlag, func(o *KeyOptions, v string) { o.NoTouchRequired = true }},
+	"verify-required":     {keyOptionFlag, func(o *KeyOptions, v string) { o.VerifyRequired = true }},
+	"readonly":            {keyOptionFlag, func(o *KeyOptions, v string) { o.ReadOnly = true }},
+	"command":             {keyOptionSingleValue, func(o *KeyOptions, v string) { o.Command = v }},
+	"from":                {keyOptionSingleValue, func(o *KeyOptions, v string) { o.From = splitOptionList(v) }},
+	"principals":          {keyOptionSingleValue, func(o *KeyOptions, v string) { o.Principals = splitOptionList(v) }},
+	"expiry-time":         {keyOptionSingleValue, func(o *KeyOptions, v string) { o.ExpiryTime = v }},
+	"valid-after":         {keyOptionSingleValue, func(o *KeyOptions, v string) { o.ValidAfter = v }},
+	"not-before":          {keyOptionSingleValue, func(o *KeyOptions, v string) { o.ValidAfter = v }},
+	"time-window":         {keyOptionSingleValue, func(o *KeyOptions, v string) { o.TimeWindow = v }},
+	"tunnel":              {keyOptionSingleValue, func(o *KeyOptions, v string) { o.Tunnel = v }},
+	"home":                {keyOptionSingleValue, func(o *KeyOptions, v string) { o.Home = v }},
+	"name":                {keyOptionSingleValue, func(o *KeyOptions, v string) { o.Name = v }},
+	"permissions":         {keyOptionSingleValue, func(o *KeyOptions, v string) { o.Permissions = splitOptionList(v) }},
+	"protocols":           {keyOptionSingleValue, func(o *KeyOptions, v string) { o.Protocols = splitOptionList(v) }},
+	"environment":         {keyOptionMultiValue, func(o *KeyOptions, v string) { o.Environment = append(o.Environment, v) }},
+	"permitopen":          {keyOptionMultiValue, func(o *KeyOptions, v string) { o.PermitOpen = append(o.PermitOpen, v) }},
+	"permitlisten":        {keyOptionMultiValue, func(o *KeyOptions, v string) { o.PermitListen = append(o.PermitListen, v) }},
+}
+
+// ParseKeyOptions parses options of a key line, as returned by ssh.ParseAuthorizedKey.
+// Options are matched case-insensitively. Values may be quoted with "", and \" is an escaped quote.
+// A flag option given a value, a value option without a value and a duplicated single value option are errors.
+// Unknown options are errors, as sshd rejects key lines with them.
+func ParseKeyOptions(options []string) (*KeyOptions, error) {
+	keyOptions := &KeyOptions{}
+
+	seen := map[string]bool{}
+
+	for _, option := range options {
+		name, value, hasValue, err := parseKeyOption(option)
+		if err != nil {
+			return nil, err
+		}
+
+		spec, ok := keyOptionSpecs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown option %q", name)
+		}
+
+		switch spec.kind {
+		case keyOptionFlag:
+			if hasValue {
+				return nil, fmt.Errorf("option %q does not take a value", name)
+			}
+		case keyOptionSingleValue:
+			if !hasValue {
+				return nil, fmt.Errorf("option %q requires a value", name)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("duplicated option %q", name)
+			}
+		case keyOptionMultiValue:
+			if !hasValue {
+				return nil, fmt.Errorf("option %q requires a value", name)
+			}
+		}
+
+		seen[name] = true
+		spec.apply(keyOptions, value)
+	}
+
+	if len(keyOptions.Name) > 0 && !commons.IsValidName(keyOptions.Name) {
+		return nil, fmt.Errorf("key name %q must consist of letters, digits, '.', '_' and '-'", keyOptions.Name)
+	}
+
+	if seen["valid-after"] && seen["not-before"] {
+		return nil, fmt.Errorf("options %q and %q must not be given together", "valid-after", "not-before")
+	}
+
+	if seen["time-window"] {
+		// zones are checked here, the location is given when the window is used
+		_, err := parseTimeWindow(keyOptions.TimeWindow, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if seen["permissions"] {
+		if len(keyOptions.Permissions) == 0 {
+			return nil, fmt.Errorf("option %q requires a value", "permissions")
+		}
+
+		for idx, permission := range keyOptions.Permissions {
+			permission = strings.ToLower(permission)
+			if !sftpgoPermissions[permission] {
+				return nil, fmt.Errorf("unknown permission %q", permission)
+			}
+			keyOptions.Permissions[idx] = permission
+		}
+	}
+
+	if seen["protocols"] {
+		if len(keyOptions.Protocols) == 0 {
+			return nil, fmt.Errorf("option %q requires a value", "protocols")
+		}
+
+		for idx, protocol := range keyOptions.Protocols {
+			if !commons.IsSFTPGoProtocol(protocol) {
+				return nil, fmt.Errorf("unknown protocol %q", protocol)
+			}
+			keyOptions.Protocols[idx] = strings.ToUpper(protocol)
+		}
+	}
+
+	return keyOptions, nil
+}
+
+// GetPermissions returns SFTPGo permissions granted on mounts for the key, nil if not limited
+// readonly limits the permissions given by permissions= to list and download
+func (options *KeyOptions) GetPermissions() []string {
+	if options == nil {
+		return nil
+	}
+
+	if !options.ReadOnly {
+		if len(options.Permissions) == 0 {
+			return nil
+		}
+		return options.Permissions
+	}
+
+	if len(options.Permissions) == 0 {
+		return GetReadOnlyPermissions()
+	}
+	return intersectPermissions(options.Permissions, readOnlyPermissions)
+}
+
+// parseKeyOption parses a single option into lower-cased name and unquoted value
+func parseKeyOption(option string) (string, string, bool, error) {
+	option = strings.TrimSpace(option)
+
+	eqIdx := strings.IndexByte(option, '=')
+	if eqIdx < 0 {
+		if len(option) == 0 {
+			return "", "", false, fmt.Errorf("empty option")
+		}
+		return strings.ToLower(option), "", false, nil
+	}
+
+	name := strings.ToLower(strings.TrimSpace(option[:eqIdx]))
+	if len(name) == 0 {
+		return "", "", false, fmt.Errorf("option %q has no name", option)
+	}
+
+	rawValue := option[eqIdx+1:]
+	if len(rawValue) == 0 || rawValue[0] != '"' {
+		// unquoted
+		return name, rawValue, true, nil
+	}
+
+	var valueBuilder strings.Builder
+	for i := 1; i < len(rawValue); i++ {
+		c := rawValue[i]
+		if c == '\\' && i+1 < len(rawValue) && rawValue[i+1] == '"' {
+			valueBuilder.WriteByte('"')
+			i++
+			continue
+		}
+
+		if c == '"' {
+			if i != len(rawValue)-1 {
+				return "", "", false, fmt.Errorf("option %q has trailing characters after a quoted value", name)
+			}
+			return name, valueBuilder.String(), true, nil
+		}
+
+		valueBuilder.WriteByte(c)
+	}
+
+	return "", "", false, fmt.Errorf("option %q has an unterminated quoted value", name)
+}
+
+// splitOptionList splits a comma separated option value
+func splitOptionList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+		want    *KeyOptions
+		wantErr string
+	}{
+		{"no options", nil, &KeyOptions{}, ""},
+		{"flags", []string{"restrict", "No-Pty"}, &KeyOptions{Restrict: true, NoPty: true}, ""},
+		{"quoted value", []string{`command="echo \"hi\""`}, &KeyOptions{Command: `echo "hi"`}, ""},
+		{"unquoted value", []string{"home=projects/lab"}, &KeyOptions{Home: "projects/lab"}, ""},
+		{"list values", []string{`from="10.0.0.0/8, !10.1.2.3"`, `principals="alice,bob"`}, &KeyOptions{From: []string{"10.0.0.0/8", "!10.1.2.3"}, Principals: []string{"alice", "bob"}}, ""},
+		{"multi values", []string{`environment="A=1"`, `environment="B=2"`}, &KeyOptions{Environment: []string{"A=1", "B=2"}}, ""},
+		{"readonly", []string{"readonly"}, &KeyOptions{ReadOnly: true}, ""},
+		{"not-before as valid-after", []string{`not-before="20200101Z"`}, &KeyOptions{ValidAfter: "20200101Z"}, ""},
+		{"permissions are lower-cased", []string{`permissions="LIST,download"`}, &KeyOptions{Permissions: []string{"list", "download"}}, ""},
+		{"protocols are upper-cased", []string{`protocols="ssh,dav"`}, &KeyOptions{Protocols: []string{"SSH", "DAV"}}, ""},
+		{"key name", []string{"name=laptop-1"}, &KeyOptions{Name: "laptop-1"}, ""},
+
+		{"unknown option", []string{"restrict", "no-such-option"}, nil, `unknown option "no-such-option"`},
+		{"unknown option with value", []string{`bogus="1"`}, nil, `unknown option "bogus"`},
+		{"flag with value", []string{"restrict=yes"}, nil, "does not take a value"},
+		{"value option without value", []string{"command"}, nil, "requires a value"},
+		{"duplicated single value", []string{"home=a", "home=b"}, nil, "duplicated option"},
+		{"unterminated quote", []string{`command="echo`}, nil, "unterminated"},
+		{"trailing characters", []string{`command="echo"x`}, nil, "trailing characters"},
+		{"empty option", []string{" "}, nil, "empty option"},
+		{"no name", []string{"=value"}, nil, "has no name"},
+		{"invalid key name", []string{"name=../x"}, nil, "key name"},
+		{"valid-after with not-before", []string{"valid-after=20200101", "not-before=20200101"}, nil, "must not be given together"},
+		{"invalid time window", []string{`time-window="Mon-Fry"`}, nil, "invalid weekday"},
+		{"unknown permission", []string{"permissions=list,chmod2"}, nil, "unknown permission"},
+		{"empty permissions", []string{`permissions=","`}, nil, "requires a value"},
+		{"unknown protocol", []string{"protocols=SSH,SMB"}, nil, "unknown protocol"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseKeyOptions(test.options)
+			if len(test.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("err = %v, want an error containing %q", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to parse options: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("options = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestKeyOptionsGetPermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *KeyOptions
+		want    []string
+	}{
+		{"nil options", nil, nil},
+		{"not limited", &KeyOptions{}, nil},
+		{"permissions", &KeyOptions{Permissions: []string{"list", "upload"}}, []string{"list", "upload"}},
+		{"readonly", &KeyOptions{ReadOnly: true}, []string{"list", "download"}},
+		{"readonly limits permissions", &KeyOptions{ReadOnly: true, Permissions: []string{"list", "upload"}}, []string{"list"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.options.GetPermissions()
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("permissions = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
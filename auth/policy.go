@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+// CheckAccessPolicy returns ErrPolicyDenied if the user is denied by the user type or groups
+// Denied user types and denied groups take precedence over allowed groups
+func CheckAccessPolicy(config *commons.Config, catalog CatalogClient) error {
+	if !config.IsAccessPolicyEnabled() {
+		return nil
+	}
+
+	username := config.SFTPGoAuthdUsername
+
+	if len(config.SFTPGoDeniedUserTypes) > 0 {
+		userType, err := catalog.GetUserType(username)
+		if err != nil {
+			return fmt.Errorf("failed to get type of the user '%s': %w", username, err)
+		}
+
+		for _, deniedUserType := range config.SFTPGoDeniedUserTypes {
+			if strings.EqualFold(userType, deniedUserType) {
+				return fmt.Errorf("user '%s' of type %s is denied: %w", username, userType, ErrPolicyDenied)
+			}
+		}
+	}
+
+	if len(config.SFTPGoAllowedGroups) == 0 && len(config.SFTPGoDeniedGroups) == 0 {
+		return nil
+	}
+
+	groups, err := catalog.ListUserGroups(username)
+	if err != nil {
+		return fmt.Errorf("failed to list groups of the user '%s': %w", username, err)
+	}
+
+	for _, group := range groups {
+		if slices.Contains(config.SFTPGoDeniedGroups, group) {
+			return fmt.Errorf("user '%s' is a member of denied group '%s': %w", username, group, ErrPolicyDenied)
+		}
+	}
+
+	if len(config.SFTPGoAllowedGroups) > 0 {
+		allowed := slices.ContainsFunc(groups, func(group string) bool {
+			return slices.Contains(config.SFTPGoAllowedGroups, group)
+		})
+		if !allowed {
+			return fmt.Errorf("user '%s' is not a member of any allowed group: %w", username, ErrPolicyDenied)
+		}
+	}
+
+	return nil
+}
+
+// GroupPolicy is a policy of a user, merged from group policies of the user's groups
+type GroupPolicy struct {
+	// AllowedProtocols are upper-cased protocols allowed by all of the policies, nil if not limited
+	AllowedProtocols []string
+	ReadOnly         bool
+	// UserMaxLifetime is the shortest user max lifetime of the policies in seconds, no limit if 0
+	UserMaxLifetime int
+}
+
+// GetGroupPolicy returns the most restrictive policy of group policies of the user's groups, nil if none applies
+func GetGroupPolicy(config *commons.Config, catalog CatalogClient) (*GroupPolicy, error) {
+	if len(config.GroupPolicies) == 0 || config.IsAnonymousUser() {
+		return nil, nil
+	}
+
+	username := config.SFTPGoAuthdUsername
+
+	groups, err := catalog.ListUserGroups(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups of the user '%s': %w", username, err)
+	}
+
+	var policy *GroupPolicy
+	for _, groupPolicy := range config.GroupPolicies {
+		if !slices.Contains(groups, groupPolicy.Group) {
+			continue
+		}
+
+		if policy == nil {
+			policy = &GroupPolicy{}
+		}
+
+		if len(groupPolicy.AllowedProtocols) > 0 {
+			protocols := []string{}
+			for _, protocol := range groupPolicy.AllowedProtocols {
+				protocols = append(protocols, strings.ToUpper(protocol))
+			}
+			policy.AllowedProtocols = intersectProtocols(policy.AllowedProtocols, protocols)
+		}
+
+		policy.ReadOnly = policy.ReadOnly || groupPolicy.ReadOnly
+
+		if groupPolicy.UserMaxLifetime > 0 && (policy.UserMaxLifetime == 0 || groupPolicy.UserMaxLifetime < policy.UserMaxLifetime) {
+			policy.UserMaxLifetime = groupPolicy.UserMaxLifetime
+		}
+	}
+
+	return policy, nil
+}
+
+// Apply limits the options by the policy
+func (policy *GroupPolicy) Apply(options *SFTPGoUserOptions) {
+	options.AllowedProtocols = intersectProtocols(options.AllowedProtocols, policy.AllowedProtocols)
+
+	if policy.ReadOnly {
+		permissions := options.Permissions
+		if permissions == nil {
+			permissions = []string{"*"}
+		}
+		options.Permissions = intersectPermissions(permissions, readOnlyPermissions)
+	}
+
+	if policy.UserMaxLifetime > 0 {
+		maxExpiresAt := time.Now().Add(time.Duration(policy.UserMaxLifetime) * time.Second)
+		if options.ExpiresAt.IsZero() || maxExpiresAt.Before(options.ExpiresAt) {
+			options.ExpiresAt = maxExpiresAt
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+func TestCheckAccessPolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowedGroups   []string
+		deniedGroups    []string
+		deniedUserTypes []string
+		catalog         *fakeCatalog
+		denied          bool
+	}{
+		{"no policy", nil, nil, nil, &fakeCatalog{"rodsadmin", nil}, false},
+		{"denied user type", nil, nil, []string{"RODSADMIN"}, &fakeCatalog{"rodsadmin", nil}, true},
+		{"other user type", nil, nil, []string{"rodsadmin"}, &fakeCatalog{"rodsuser", nil}, false},
+		{"not in allowed groups", []string{"lab"}, nil, nil, &fakeCatalog{"rodsuser", []string{"public"}}, true},
+		{"in allowed groups", []string{"lab"}, nil, nil, &fakeCatalog{"rodsuser", []string{"public", "lab"}}, false},
+		{"denied group wins", []string{"lab"}, []string{"svc"}, nil, &fakeCatalog{"rodsuser", []string{"lab", "svc"}}, true},
+		{"not in denied groups", nil, []string{"svc"}, nil, &fakeCatalog{"rodsuser", []string{"lab"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &commons.Config{
+				SFTPGoAuthdUsername:   "user1",
+				SFTPGoAllowedGroups:   test.allowedGroups,
+				SFTPGoDeniedGroups:    test.deniedGroups,
+				SFTPGoDeniedUserTypes: test.deniedUserTypes,
+			}
+
+			err := CheckAccessPolicy(config, test.catalog)
+			if errors.Is(err, ErrPolicyDenied) != test.denied {
+				t.Errorf("err = %v, denied = %t", err, test.denied)
+			}
+			if !test.denied && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetGroupPolicy(t *testing.T) {
+	groupPolicies := []commons.GroupPolicyConfig{
+		{Group: "students", AllowedProtocols: []string{"ssh", "dav"}, UserMaxLifetime: 3600},
+		{Group: "guests", AllowedProtocols: []string{"DAV", "HTTP"}, ReadOnly: true, UserMaxLifetime: 600},
+		{Group: "staff", UserMaxLifetime: 7200},
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		groups   []string
+		want     *GroupPolicy
+	}{
+		{"no group policy", "user1", []string{"public"}, nil},
+		{"single policy", "user1", []string{"students"}, &GroupPolicy{AllowedProtocols: []string{"SSH", "DAV"}, UserMaxLifetime: 3600}},
+		{"most restrictive of policies", "user1", []string{"students", "guests"}, &GroupPolicy{AllowedProtocols: []string{"DAV"}, ReadOnly: true, UserMaxLifetime: 600}},
+		{"policy without protocols does not limit protocols", "user1", []string{"staff"}, &GroupPolicy{UserMaxLifetime: 7200}},
+		{"policy without protocols keeps other limits", "user1", []string{"staff", "students"}, &GroupPolicy{AllowedProtocols: []string{"SSH", "DAV"}, UserMaxLifetime: 3600}},
+		{"anonymous", "anonymous", []string{"guests"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &commons.Config{
+				SFTPGoAuthdUsername: test.username,
+				GroupPolicies:       groupPolicies,
+			}
+
+			got, err := GetGroupPolicy(config, &fakeCatalog{"rodsuser", test.groups})
+			if err != nil {
+				t.Fatalf("failed to get group policy: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("policy = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetGroupPolicyNoCommonProtocol(t *testing.T) {
+	config := &commons.Config{
+		SFTPGoAuthdUsername: "user1",
+		GroupPolicies: []commons.GroupPolicyConfig{
+			{Group: "a", AllowedProtocols: []string{"SSH"}},
+			{Group: "b", AllowedProtocols: []string{"DAV"}},
+		},
+	}
+
+	policy, err := GetGroupPolicy(config, &fakeCatalog{"rodsuser", []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("failed to get group policy: %v", err)
+	}
+
+	// no protocol is allowed, rather than no limit
+	if policy.AllowedProtocols == nil || len(policy.AllowedProtocols) != 0 {
+		t.Errorf("allowed protocols = %#v, want empty", policy.AllowedProtocols)
+	}
+}
+
+func TestGroupPolicyApply(t *testing.T) {
+	now := time.Now()
+	later := now.Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		policy  GroupPolicy
+		options SFTPGoUserOptions
+		want    SFTPGoUserOptions
+	}{
+		{"no limit", GroupPolicy{}, SFTPGoUserOptions{}, SFTPGoUserOptions{}},
+		{"protocols", GroupPolicy{AllowedProtocols: []string{"SSH"}}, SFTPGoUserOptions{}, SFTPGoUserOptions{AllowedProtocols: []string{"SSH"}}},
+		{"protocols intersect", GroupPolicy{AllowedProtocols: []string{"SSH", "DAV"}}, SFTPGoUserOptions{AllowedProtocols: []string{"DAV", "FTP"}}, SFTPGoUserOptions{AllowedProtocols: []string{"DAV"}}},
+		{"readonly", GroupPolicy{ReadOnly: true}, SFTPGoUserOptions{}, SFTPGoUserOptions{Permissions: []string{"list", "download"}}},
+		{"readonly limits permissions", GroupPolicy{ReadOnly: true}, SFTPGoUserOptions{Permissions: []string{"list", "upload"}}, SFTPGoUserOptions{Permissions: []string{"list"}}},
+		{"earlier expiry is kept", GroupPolicy{UserMaxLifetime: 3600}, SFTPGoUserOptions{ExpiresAt: now}, SFTPGoUserOptions{ExpiresAt: now}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options
+			test.policy.Apply(&options)
+			if !reflect.DeepEqual(options, test.want) {
+				t.Errorf("options = %+v, want %+v", options, test.want)
+			}
+		})
+	}
+
+	t.Run("max lifetime", func(t *testing.T) {
+		options := SFTPGoUserOptions{ExpiresAt: later}
+		policy := GroupPolicy{UserMaxLifetime: 3600}
+		policy.Apply(&options)
+
+		if options.ExpiresAt.After(time.Now().Add(time.Hour)) || options.ExpiresAt.Before(now.Add(time.Hour)) {
+			t.Errorf("expires at %s, want an hour later", options.ExpiresAt)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetAllowedProtocols returns protocols allowed by both of the config and the key options, nil if not limited
+// options can be nil for password auth
+func GetAllowedProtocols(config *commons.Config, options *KeyOptions) []string {
+	allowedProtocols := config.GetAllowedProtocols()
+	if options == nil {
+		return allowedProtocols
+	}
+	return intersectProtocols(allowedProtocols, options.Protocols)
+}
+
+// intersectProtocols returns protocols allowed by both, nil means not limited
+func intersectProtocols(protocols []string, limits []string) []string {
+	if limits == nil {
+		return protocols
+	}
+
+	if protocols == nil {
+		return limits
+	}
+
+	intersection := []string{}
+	for _, protocol := range protocols {
+		for _, limit := range limits {
+			if protocol == limit {
+				intersection = append(intersection, protocol)
+				break
+			}
+		}
+	}
+	return intersection
+}
+
+// CheckProtocol returns ErrProtocolDenied if the protocol of the request is not in allowed protocols
+// Requests without a protocol are denied if protocols are limited, allowedProtocols is nil if not limited
+func CheckProtocol(config *commons.Config, allowedProtocols []string) error {
+	if allowedProtocols == nil {
+		return nil
+	}
+
+	if len(config.SFTPGoAuthdProtocol) == 0 {
+		// old SFTPGo versions do not give a protocol, the restriction cannot be enforced
+		log.Warnf("denying the user '%s' as protocols are limited to %v but the request has no protocol", config.SFTPGoAuthdUsername, allowedProtocols)
+		return fmt.Errorf("the user '%s' cannot log in without a protocol: %w", config.SFTPGoAuthdUsername, ErrProtocolDenied)
+	}
+
+	for _, protocol := range allowedProtocols {
+		if strings.EqualFold(protocol, config.SFTPGoAuthdProtocol) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the user '%s' cannot log in over %s: %w", config.SFTPGoAuthdUsername, config.SFTPGoAuthdProtocol, ErrProtocolDenied)
+}
+
+// getDeniedProtocols returns SFTPGo protocols not in allowed protocols
+func getDeniedProtocols(allowedProtocols []string) []string {
+	deniedProtocols := []string{}
+	if allowedProtocols == nil {
+		return deniedProtocols
+	}
+
+	for _, protocol := range commons.SFTPGoProtocols {
+		allowed := false
+		for _, allowedProtocol := range allowedProtocols {
+			if allowedProtocol == protocol {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			deniedProtocols = append(deniedProtocols, protocol)
+		}
+	}
+	return deniedProtocols
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+func TestCheckProtocol(t *testing.T) {
+	tests := []struct {
+		name             string
+		protocol         string
+		allowedProtocols []string
+		denied           bool
+	}{
+		{"not limited", "FTP", nil, false},
+		{"not limited without protocol", "", nil, false},
+		{"allowed", "SSH", []string{"SSH", "DAV"}, false},
+		{"allowed in other case", "ssh", []string{"SSH"}, false},
+		{"denied", "FTP", []string{"SSH", "DAV"}, true},
+		{"nothing allowed", "SSH", []string{}, true},
+		{"limited without protocol", "", []string{"SSH"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &commons.Config{
+				SFTPGoAuthdUsername: "user1",
+				SFTPGoAuthdProtocol: test.protocol,
+			}
+
+			err := CheckProtocol(config, test.allowedProtocols)
+			if test.denied != errors.Is(err, ErrProtocolDenied) {
+				t.Errorf("err = %v, denied = %t", err, test.denied)
+			}
+			if !test.denied && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
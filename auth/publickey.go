@@ -3,10 +3,9 @@ package auth
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
-	"net"
 	"path"
-	"regexp"
 	"strings"
 	"time"
 
@@ -15,11 +14,34 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-func checkAuthorizedKey(authorizedKeys []byte, userKey ssh.PublicKey) (bool, []string) {
+// AuthorizedKey is a line in authorized_keys that matched a user key
+type AuthorizedKey struct {
+	// PublicKey is the key in the line, a CA key for cert-authority lines
+	PublicKey ssh.PublicKey
+	Options   *KeyOptions
+	// Source is the name of the key source having the line
+	Source string
+	// LineNumber is a 1-based line number in authorized_keys lines of the source
+	LineNumber int
+	// SameTypeHomeKeys is the number of lines having home= option and the same key type as the matched line
+	SameTypeHomeKeys int
+	// Line is the matched line
+	Line string
+}
+
+func checkAuthorizedKey(authorizedKeys []byte, userKey ssh.PublicKey, username string, clientIP string) (bool, *AuthorizedKey) {
+	userCert, isUserCert := userKey.(*ssh.Certificate)
+
 	authorizedKeysReader := bytes.NewReader(authorizedKeys)
 	authorizedKeysScanner := bufio.NewScanner(authorizedKeysReader)
 
+	var matchedKey *AuthorizedKey
+	homeKeyTypes := map[string]int{}
+
+	lineNumber := 0
 	for authorizedKeysScanner.Scan() {
+		lineNumber++
+
 		authorizedKeyLine := strings.TrimSpace(authorizedKeysScanner.Text())
 		if authorizedKeyLine == "" || authorizedKeyLine[0] == '#' {
 			// skip
@@ -29,174 +51,143 @@ func checkAuthorizedKey(authorizedKeys []byte, userKey ssh.PublicKey) (bool, []s
 		authorizedKey, _, options, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKeyLine))
 		if err != nil {
 			// skip invalid public key
-			log.Debugf("failed to parse a authorized key line - %s", err.Error())
+			log.Debugf("failed to parse a authorized key line %d - %s", lineNumber, err.Error())
 			continue
 		}
 
-		if bytes.Equal(authorizedKey.Marshal(), userKey.Marshal()) {
-			// found
-			return true, options
+		keyOptions, err := ParseKeyOptions(options)
+		if err != nil {
+			// reject the line with invalid options
+			log.Warnf("rejected authorized key line %d - %s", lineNumber, err.Error())
+			continue
 		}
-	}
 
-	return false, nil
-}
+		if len(keyOptions.Home) > 0 && !keyOptions.CertAuthority {
+			homeKeyTypes[authorizedKey.Type()]++
+		}
+
+		if matchedKey != nil {
+			// already found, keep counting home keys
+			continue
+		}
 
-func IsKeyExpired(options []string) bool {
-	for _, option := range options {
-		optKV := strings.Split(option, "=")
-		if len(optKV) == 2 {
-			optK := strings.TrimSpace(optKV[0])
-			if strings.ToLower(optK) == "expiry-time" {
-				optV := strings.TrimSpace(optKV[1])
-				optV = strings.Trim(optV, "\"")
-
-				var expiryDate time.Time
-				if len(optV) == 8 {
-					// "YYYYMMDD" format
-					d, err := time.ParseInLocation("20060102", optV, time.Local)
-					if err != nil {
-						log.Debugf("failed to parse expiry date '%s'", optV)
-						return true
-					}
-					expiryDate = d
-				} else if len(optV) == 12 {
-					// "YYYYMMDDHHMM" format
-					d, err := time.ParseInLocation("200601021504", optV, time.Local)
-					if err != nil {
-						log.Debugf("failed to parse expiry date '%s'", optV)
-						return true
-					}
-					expiryDate = d
-				} else if len(optV) == 14 {
-					// "YYYYMMDDHHMMSS" format
-					d, err := time.ParseInLocation("20060102150405", optV, time.Local)
-					if err != nil {
-						log.Debugf("failed to parse expiry date '%s'", optV)
-						return true
-					}
-					expiryDate = d
-				} else {
-					d, err := time.ParseInLocation("2006-01-02 15:04:05", optV, time.Local)
-					if err != nil {
-						log.Debugf("failed to parse expiry date '%s'", optV)
-						return true
-					}
-					expiryDate = d
-				}
-
-				nowTime := time.Now()
-				log.Debugf("nowTime: %v, expiryDate: %v", nowTime, expiryDate)
-				return nowTime.After(expiryDate)
+		if keyOptions.CertAuthority {
+			// certificates are only accepted via cert-authority lines
+			if !isUserCert {
+				continue
 			}
+
+			err = checkCertificate(userCert, authorizedKey, keyOptions, username, clientIP)
+			if err != nil {
+				log.Debugf("certificate is not accepted by a cert-authority line %d - %s", lineNumber, err.Error())
+				continue
+			}
+		} else if !bytes.Equal(authorizedKey.Marshal(), userKey.Marshal()) {
+			continue
 		}
+
+		// found
+		matchedKey = &AuthorizedKey{
+			PublicKey:  authorizedKey,
+			Options:    keyOptions,
+			LineNumber: lineNumber,
+			Line:       authorizedKeyLine,
+		}
+	}
+
+	if matchedKey == nil {
+		return false, nil
+	}
+
+	if !matchedKey.Options.CertAuthority {
+		matchedKey.SameTypeHomeKeys = homeKeyTypes[matchedKey.PublicKey.Type()]
 	}
-	// if nothing is specified, not expired
-	return false
+
+	return true, matchedKey
 }
 
-func IsClientRejected(clientIP string, options []string) bool {
-	for _, option := range options {
-		optKV := strings.Split(option, "=")
-		if len(optKV) == 2 {
-			optK := strings.TrimSpace(optKV[0])
-			if strings.ToLower(optK) == "from" {
-				optV := strings.TrimSpace(optKV[1])
-				optV = strings.Trim(optV, "\"")
-
-				// comma separated strings
-				ipFilters := strings.Split(optV, ",")
-				if len(ipFilters) == 0 {
-					// all allowed
-					return false
-				}
-
-				rejected := true
-				for _, ipFilter := range ipFilters {
-					ipFilter = strings.TrimSpace(ipFilter)
-					if len(ipFilter) > 0 {
-						if ipFilter[0] == '!' {
-							// negated - check rejected
-							if matchIP(clientIP, ipFilter[1:]) {
-								// reject if it matches
-								log.Debugf("client %s is rejected because it matches to %s", clientIP, ipFilter)
-								return true
-							}
-						} else {
-							// check accepted
-							if matchIP(clientIP, ipFilter) {
-								rejected = false
-							}
-						}
-					}
-				}
-
-				return rejected
-			}
-		}
+// IsKeyExpired checks if expiry-time of the key is passed, expiry times without a zone are in the location
+// Invalid expiry times are regarded as expired
+func IsKeyExpired(options *KeyOptions, location *time.Location) bool {
+	if options == nil || len(options.ExpiryTime) == 0 {
+		// if nothing is specified, not expired
+		return false
+	}
+
+	expiryDate, err := GetKeyExpiryTime(options, location)
+	if err != nil {
+		log.Debugf("failed to parse expiry date '%s' - %s", options.ExpiryTime, err.Error())
+		return true
 	}
-	// if nothing is specified, client is not rejected
-	return false
+
+	nowTime := time.Now()
+	log.Debugf("nowTime: %v, expiryDate: %v", nowTime, expiryDate)
+	return nowTime.After(expiryDate)
 }
 
-func matchIP(clientIP string, filter string) bool {
-	if strings.Index(filter, "/") > 0 {
-		// filter is a mask
-		// 1.2.3.4/32 pattern
-		_, filterIPNet, err := net.ParseCIDR(filter)
-		if err != nil {
-			return false
-		}
+// GetKeyExpiryTime returns expiry-time of the key, zero time if not given
+// Expiry times without a zone are in the location
+func GetKeyExpiryTime(options *KeyOptions, location *time.Location) (time.Time, error) {
+	if options == nil || len(options.ExpiryTime) == 0 {
+		return time.Time{}, nil
+	}
+
+	return ParseKeyTime(options.ExpiryTime, location)
+}
 
-		ip := net.ParseIP(clientIP)
-		return filterIPNet.Contains(ip)
+// IsKeyNotYetValid checks if valid-after of the key is not reached, times without a zone are in the location
+// Invalid times are regarded as not reached
+func IsKeyNotYetValid(options *KeyOptions, location *time.Location) bool {
+	if options == nil || len(options.ValidAfter) == 0 {
+		return false
 	}
 
-	// filter is an IP address containing ? or *
-	filterRegexp := wildCardToRegexp(filter)
-	matched, err := regexp.MatchString(filterRegexp, clientIP)
+	validAfter, err := ParseKeyTime(options.ValidAfter, location)
 	if err != nil {
+		log.Debugf("failed to parse valid-after date '%s' - %s", options.ValidAfter, err.Error())
+		return true
+	}
+
+	return time.Now().Before(validAfter)
+}
+
+// IsKeyOutsideTimeWindow checks if now is outside time-window of the key, windows without a zone are in the location
+// Invalid windows are regarded as outside
+func IsKeyOutsideTimeWindow(options *KeyOptions, location *time.Location) bool {
+	if options == nil || len(options.TimeWindow) == 0 {
 		return false
 	}
 
-	return matched
+	window, err := parseTimeWindow(options.TimeWindow, location)
+	if err != nil {
+		log.Debugf("failed to parse time window '%s' - %s", options.TimeWindow, err.Error())
+		return true
+	}
+
+	return !window.contains(time.Now())
 }
 
-// wildCardToRegexp converts a wildcard pattern to a regular expression pattern.
-func wildCardToRegexp(pattern string) string {
-	regexString := ""
-	for _, c := range pattern {
-		if c == '*' {
-			regexString += ".*"
-		} else if c == '?' {
-			regexString += ".?"
-		} else {
-			regexString += regexp.QuoteMeta(string(c))
-		}
+// IsClientRejected checks if the client is rejected by from= option, resolving hostnames of the client within ctx
+func IsClientRejected(ctx context.Context, clientIP string, options *KeyOptions) bool {
+	if options == nil || options.From == nil {
+		// if nothing is specified, client is not rejected
+		return false
 	}
 
-	return regexString
+	return !matchFromPatterns(ctx, clientIP, options.From)
 }
 
 // GetHomeCollectionPath returns home collection path
-func GetHomeCollectionPath(config *commons.Config, options []string) string {
+func GetHomeCollectionPath(config *commons.Config, options *KeyOptions) string {
 	userHome := fmt.Sprintf("/%s/home/%s", config.IRODSZone, config.SFTPGoAuthdUsername)
 
-	for _, option := range options {
-		optKV := strings.Split(option, "=")
-		if len(optKV) == 2 {
-			optK := strings.TrimSpace(optKV[0])
-			if strings.ToLower(optK) == "home" {
-				optV := strings.TrimSpace(optKV[1])
-				optV = strings.Trim(optV, "\"")
-
-				if optV[0] == '/' {
-					// absolute
-					return optV
-				}
-				return path.Join(userHome, optV)
-			}
-		}
+	if options == nil || len(options.Home) == 0 {
+		return userHome
+	}
+
+	if options.Home[0] == '/' {
+		// absolute
+		return options.Home
 	}
-	return userHome
+	return path.Join(userHome, options.Home)
 }
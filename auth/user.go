@@ -2,12 +2,16 @@ package auth
 
 import (
 	"fmt"
+	"os"
 	"path"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/cyverse/sftpgo-auth-irods/commons"
 	"github.com/cyverse/sftpgo-auth-irods/types"
 	"github.com/sftpgo/sdk"
+	log "github.com/sirupsen/logrus"
 )
 
 func makeLocalUserPath(config *commons.Config, sftpgoUsername string) string {
@@ -18,23 +22,62 @@ func makeLocalUserSubPath(config *commons.Config, sftpgoUsername string, name st
 	return path.Join(config.SFTPGoHomeDir, sftpgoUsername, name)
 }
 
-func makePermissions(config *commons.Config, mountPaths []types.MountPath) map[string][]string {
+func makePermissions(config *commons.Config, mountPaths []types.MountPath, options SFTPGoUserOptions) map[string][]string {
 	permissions := make(map[string][]string)
 	permissions["/"] = []string{"list"}
 
+	mountPermissions := []string{"*"}
+	if options.Permissions != nil {
+		mountPermissions = options.Permissions
+	}
+
 	for _, mountPath := range mountPaths {
 		p := fmt.Sprintf("/%s", mountPath.DirName)
-		permissions[p] = []string{"*"}
+		if mountPath.Permissions != nil {
+			permissions[p] = intersectPermissions(mountPermissions, mountPath.Permissions)
+		} else {
+			permissions[p] = mountPermissions
+		}
 	}
 
 	return permissions
 }
 
-func makeFilters(config *commons.Config) *types.SFTPGoUserFilter {
+func makeFilters(config *commons.Config, options SFTPGoUserOptions) *types.SFTPGoUserFilter {
 	return &types.SFTPGoUserFilter{
 		AllowedIP:          []string{},
 		DeniedLoginMethods: []string{},
+		DeniedProtocols:    getDeniedProtocols(options.AllowedProtocols),
+	}
+}
+
+// makeExpirationDate returns SFTPGo expiration date in unix milliseconds,
+// the earliest of ExpiresAt, the user max lifetime and the lifetime of the session token
+func makeExpirationDate(config *commons.Config, options SFTPGoUserOptions) int64 {
+	expiresAt := options.ExpiresAt
+
+	if config.SFTPGoUserMaxLifetime > 0 {
+		expiresAt = limitExpiresAt(expiresAt, time.Duration(config.SFTPGoUserMaxLifetime)*time.Second)
+	}
+
+	if len(options.SessionToken) > 0 && config.IRODSPAMTTL > 0 {
+		// SFTPGo cannot access iRODS with the token after it expires
+		expiresAt = limitExpiresAt(expiresAt, time.Duration(config.IRODSPAMTTL)*time.Hour)
+	}
+
+	if expiresAt.IsZero() {
+		return 0
+	}
+	return expiresAt.UnixMilli()
+}
+
+// limitExpiresAt returns the earlier of expiresAt and the lifetime from now, zero expiresAt is no expiration
+func limitExpiresAt(expiresAt time.Time, lifetime time.Duration) time.Time {
+	maxExpiresAt := time.Now().Add(lifetime)
+	if expiresAt.IsZero() || maxExpiresAt.Before(expiresAt) {
+		return maxExpiresAt
 	}
+	return expiresAt
 }
 
 func makeLocalFileSystem() *types.SFTPGoFileSystem {
@@ -43,7 +86,30 @@ func makeLocalFileSystem() *types.SFTPGoFileSystem {
 	}
 }
 
-func makeFileSystem(config *commons.Config, collectionPath string) *types.SFTPGoFileSystem {
+// makeSecret returns a SFTPGoSecret for the password in the configured secret format
+func makeSecret(config *commons.Config, password string, additionalData string) (*types.SFTPGoSecret, error) {
+	secretFormat := strings.ToLower(config.SFTPGoSecretFormat)
+	if secretFormat == "" || secretFormat == "plain" {
+		return types.NewSFTPGoSecretForUserPassword(password), nil
+	}
+
+	// SFTPGo uses the exact file content as a master key
+	masterKey, err := os.ReadFile(config.SFTPGoSecretMasterKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file %q: %w", config.SFTPGoSecretMasterKeyPath, err)
+	}
+
+	switch secretFormat {
+	case "aes-256-gcm":
+		return types.NewSFTPGoSecretAES256GCM(password, additionalData, masterKey)
+	case "secretbox":
+		return types.NewSFTPGoSecretSecretbox(password, additionalData, masterKey)
+	default:
+		return nil, fmt.Errorf("unknown secret format %s", config.SFTPGoSecretFormat)
+	}
+}
+
+func makeFileSystem(config *commons.Config, sftpgoUsername string, collectionPath string, options SFTPGoUserOptions) (*types.SFTPGoFileSystem, error) {
 	authScheme := config.IRODSAuthScheme
 	if strings.ToLower(config.IRODSAuthScheme) == "pam_for_users" {
 		if config.IsProxyAuth() {
@@ -54,17 +120,35 @@ func makeFileSystem(config *commons.Config, collectionPath string) *types.SFTPGo
 	}
 
 	password := config.SFTPGoAuthdPassword
+	proxyUsername := config.IRODSProxyUsername
 	if len(config.IRODSProxyUsername) > 0 {
 		password = config.IRODSProxyPassword
 	}
 
+	if len(options.SessionToken) > 0 {
+		// PAM tokens are used with native auth, without proxy
+		authScheme = "native"
+		password = options.SessionToken
+		proxyUsername = ""
+	}
+
+	secret, err := makeSecret(config, password, sftpgoUsername)
+	if err != nil {
+		return nil, err
+	}
+
+	host := config.IRODSHost
+	if len(options.Host) > 0 {
+		host = options.Host
+	}
+
 	return &types.SFTPGoFileSystem{
 		Provider: sdk.IRODSFilesystemProvider,
 		IRODSConfig: &types.SFTPGoIRODSFsConfig{
-			Endpoint:                       fmt.Sprintf("%s:%d", config.IRODSHost, config.IRODSPort),
+			Endpoint:                       fmt.Sprintf("%s:%d", host, config.IRODSPort),
 			Username:                       config.SFTPGoAuthdUsername,
-			ProxyUsername:                  config.IRODSProxyUsername,
-			Password:                       types.NewSFTPGoSecretForUserPassword(password),
+			ProxyUsername:                  proxyUsername,
+			Password:                       secret,
 			CollectionPath:                 collectionPath,
 			Resource:                       "",
 			AuthScheme:                     authScheme,
@@ -75,11 +159,13 @@ func makeFileSystem(config *commons.Config, collectionPath string) *types.SFTPGo
 			SSLAlgorithm:                   config.IRODSSSLAlgorithm,
 			SSLSaltSize:                    config.IRODSSSLSaltSize,
 			SSLHashRounds:                  config.IRODSSSLHashRounds,
+			SSLVerifyServer:                strings.ToLower(config.IRODSSSLVerifyServer),
+			SSLServerName:                  config.IRODSSSLServerName,
 		},
-	}
+	}, nil
 }
 
-func makeVirtualFolders(config *commons.Config, sftpgoUsername string, mountPaths []types.MountPath) ([]types.SFTPGoVirtualFolder, error) {
+func makeVirtualFolders(config *commons.Config, sftpgoUsername string, mountPaths []types.MountPath, options SFTPGoUserOptions) ([]types.SFTPGoVirtualFolder, error) {
 	vfolders := []types.SFTPGoVirtualFolder{}
 	reservedNames := map[string]bool{}
 
@@ -89,12 +175,17 @@ func makeVirtualFolders(config *commons.Config, sftpgoUsername string, mountPath
 			return nil, fmt.Errorf("duplicated virtual folder name %s", mountPath.Name)
 		}
 
+		fileSystem, err := makeFileSystem(config, sftpgoUsername, mountPath.CollectionPath, options)
+		if err != nil {
+			return nil, err
+		}
+
 		vfolder := types.SFTPGoVirtualFolder{
 			Name:        mountPath.Name,
 			Description: mountPath.Description,
 			MappedPath:  makeLocalUserSubPath(config, sftpgoUsername, mountPath.DirName),
 			VirtualPath: fmt.Sprintf("/%s", mountPath.DirName),
-			FileSystem:  makeFileSystem(config, mountPath.CollectionPath),
+			FileSystem:  fileSystem,
 		}
 
 		vfolders = append(vfolders, vfolder)
@@ -105,8 +196,45 @@ func makeVirtualFolders(config *commons.Config, sftpgoUsername string, mountPath
 	return vfolders, nil
 }
 
-func MakeSFTPGoUser(config *commons.Config, sftpgoUsername string, mountPaths []types.MountPath) (*types.SFTPGoUser, error) {
-	vfolders, err := makeVirtualFolders(config, sftpgoUsername, mountPaths)
+// dropCollidingMountPaths returns the mount paths without those whose dir names collide with earlier ones
+// SFTPGo rejects the whole user if virtual paths are the same or mapped paths overlap,
+// such as a project mount of a group named like the user or like the shared_with_me dir
+func dropCollidingMountPaths(mountPaths []types.MountPath) []types.MountPath {
+	keptMountPaths := []types.MountPath{}
+	for _, mountPath := range mountPaths {
+		dirPath := path.Join("/", mountPath.DirName)
+		if slices.ContainsFunc(keptMountPaths, func(keptMountPath types.MountPath) bool {
+			keptDirPath := path.Join("/", keptMountPath.DirName)
+			return commons.IsPathUnder(dirPath, keptDirPath) || commons.IsPathUnder(keptDirPath, dirPath)
+		}) {
+			log.Warnf("skipping mount %q, its dir name %q collides with another mount", mountPath.Name, mountPath.DirName)
+			continue
+		}
+
+		keptMountPaths = append(keptMountPaths, mountPath)
+	}
+	return keptMountPaths
+}
+
+// SFTPGoUserOptions are per-login options for making a SFTPGoUser
+type SFTPGoUserOptions struct {
+	// SessionToken is a PAM token issued by iRODS, given to SFTPGo instead of passwords
+	SessionToken string
+	// Host is the iRODS host SFTPGo connects to, the host that accepted the auth. The first iRODS host if not given
+	Host string
+	// Permissions are SFTPGo permissions granted on mounts, all permissions if nil
+	Permissions []string
+	// AllowedProtocols are SFTPGo protocols the user can use, all protocols if nil
+	AllowedProtocols []string
+	// ExpiresAt is when the user expires, such as expiry of the key, no expiration if zero
+	// The user max lifetime in config applies too
+	ExpiresAt time.Time
+}
+
+func MakeSFTPGoUser(config *commons.Config, sftpgoUsername string, mountPaths []types.MountPath, options SFTPGoUserOptions) (*types.SFTPGoUser, error) {
+	mountPaths = dropCollidingMountPaths(mountPaths)
+
+	vfolders, err := makeVirtualFolders(config, sftpgoUsername, mountPaths, options)
 	if err != nil {
 		return nil, err
 	}
@@ -116,8 +244,9 @@ func MakeSFTPGoUser(config *commons.Config, sftpgoUsername string, mountPaths []
 		Username:       sftpgoUsername,
 		HomeDir:        makeLocalUserPath(config, sftpgoUsername),
 		VirtualFolders: vfolders,
-		Permissions:    makePermissions(config, mountPaths),
-		Filters:        makeFilters(config),
+		Permissions:    makePermissions(config, mountPaths, options),
+		Filters:        makeFilters(config, options),
 		FileSystem:     makeLocalFileSystem(),
+		ExpirationDate: makeExpirationDate(config, options),
 	}, nil
 }
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+)
+
+func newTestUserConfig() *commons.Config {
+	return &commons.Config{
+		IRODSHost:            "irods.example.com",
+		IRODSPort:            1247,
+		IRODSZone:            "zone",
+		IRODSAuthScheme:      "pam",
+		IRODSPAMSessionToken: true,
+		IRODSPAMTTL:          8,
+		SFTPGoAuthdUsername:  "user1",
+		SFTPGoAuthdPassword:  "password",
+		SFTPGoSecretFormat:   "plain",
+	}
+}
+
+func TestMakeFileSystemSessionToken(t *testing.T) {
+	tests := []struct {
+		name              string
+		proxy             bool
+		sessionToken      string
+		wantAuthScheme    string
+		wantProxyUsername string
+		wantPassword      string
+	}{
+		{"user password", false, "", "pam", "", "password"},
+		{"proxy password", true, "", "pam", "proxy", "proxy_password"},
+		{"session token", false, "token", "native", "", "token"},
+		{"session token over proxy", true, "token", "native", "", "token"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newTestUserConfig()
+			if test.proxy {
+				config.IRODSProxyUsername = "proxy"
+				config.IRODSProxyPassword = "proxy_password"
+			}
+
+			fileSystem, err := makeFileSystem(config, "user1", "/zone/home/user1", SFTPGoUserOptions{
+				SessionToken: test.sessionToken,
+				Host:         "irods2.example.com",
+			})
+			if err != nil {
+				t.Fatalf("failed to make a file system: %v", err)
+			}
+
+			irodsConfig := fileSystem.IRODSConfig
+			if irodsConfig.AuthScheme != test.wantAuthScheme {
+				t.Errorf("auth scheme = %q, want %q", irodsConfig.AuthScheme, test.wantAuthScheme)
+			}
+			if irodsConfig.ProxyUsername != test.wantProxyUsername {
+				t.Errorf("proxy username = %q, want %q", irodsConfig.ProxyUsername, test.wantProxyUsername)
+			}
+			if irodsConfig.Password.Payload != test.wantPassword {
+				t.Errorf("password = %q, want %q", irodsConfig.Password.Payload, test.wantPassword)
+			}
+			if irodsConfig.Username != "user1" || irodsConfig.Endpoint != "irods2.example.com:1247" {
+				t.Errorf("user = %q, endpoint = %q", irodsConfig.Username, irodsConfig.Endpoint)
+			}
+		})
+	}
+}
+
+func TestMakeExpirationDateSessionToken(t *testing.T) {
+	config := newTestUserConfig()
+
+	if got := makeExpirationDate(config, SFTPGoUserOptions{}); got != 0 {
+		t.Errorf("user without a session token expires at %d", got)
+	}
+
+	before := time.Now()
+	got := makeExpirationDate(config, SFTPGoUserOptions{SessionToken: "token"})
+	after := time.Now()
+
+	ttl := time.Duration(config.IRODSPAMTTL) * time.Hour
+	if got < before.Add(ttl).UnixMilli() || got > after.Add(ttl).UnixMilli() {
+		t.Errorf("user with a session token expires at %d, want the PAM TTL from now", got)
+	}
+
+	config.IRODSPAMTTL = 0
+	if got := makeExpirationDate(config, SFTPGoUserOptions{SessionToken: "token"}); got != 0 {
+		t.Errorf("user expires at %d without a PAM TTL", got)
+	}
+}
+
+func TestMakeExpirationDate(t *testing.T) {
+	tests := []struct {
+		name           string
+		keyExpiresIn   time.Duration
+		maxLifetime    int
+		groupLifetime  int
+		wantKeyExpiry  bool
+		wantLifetimeIn time.Duration
+	}{
+		{"no expiration", 0, 0, 0, false, 0},
+		{"key expiry", 2 * time.Hour, 0, 0, true, 0},
+		{"max lifetime", 0, 3600, 0, false, time.Hour},
+		{"group policy lifetime", 0, 0, 1800, false, 30 * time.Minute},
+		{"key expiry is the earliest", 10 * time.Minute, 3600, 1800, true, 0},
+		{"max lifetime is the earliest", 2 * time.Hour, 600, 1800, false, 10 * time.Minute},
+		{"group policy lifetime is the earliest", 2 * time.Hour, 3600, 300, false, 5 * time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newTestUserConfig()
+			config.SFTPGoUserMaxLifetime = test.maxLifetime
+
+			before := time.Now()
+
+			options := SFTPGoUserOptions{}
+			keyExpiresAt := time.Time{}
+			if test.keyExpiresIn > 0 {
+				keyExpiresAt = before.Add(test.keyExpiresIn)
+				options.ExpiresAt = keyExpiresAt
+			}
+
+			if test.groupLifetime > 0 {
+				policy := &GroupPolicy{UserMaxLifetime: test.groupLifetime}
+				policy.Apply(&options)
+			}
+
+			got := makeExpirationDate(config, options)
+			after := time.Now()
+
+			switch {
+			case test.wantKeyExpiry:
+				if got != keyExpiresAt.UnixMilli() {
+					t.Errorf("expiration date = %d, want the key expiry %d", got, keyExpiresAt.UnixMilli())
+				}
+			case test.wantLifetimeIn > 0:
+				if got < before.Add(test.wantLifetimeIn).UnixMilli() || got > after.Add(test.wantLifetimeIn).UnixMilli() {
+					t.Errorf("expiration date = %d, want %s from now in unix milliseconds", got, test.wantLifetimeIn)
+				}
+			default:
+				if got != 0 {
+					t.Errorf("expiration date = %d, want no expiration", got)
+				}
+			}
+		})
+	}
+}
+
+func TestMakeFileSystemSSLVerification(t *testing.T) {
+	config := newTestUserConfig()
+	config.IRODSSSLVerifyServer = "HOSTNAME"
+	config.IRODSSSLServerName = "irods.internal"
+
+	fileSystem, err := makeFileSystem(config, "user1", "/zone/home/user1", SFTPGoUserOptions{})
+	if err != nil {
+		t.Fatalf("failed to make a file system: %v", err)
+	}
+
+	if fileSystem.IRODSConfig.SSLVerifyServer != "hostname" || fileSystem.IRODSConfig.SSLServerName != "irods.internal" {
+		t.Errorf("SSL verification = %q, server name = %q", fileSystem.IRODSConfig.SSLVerifyServer, fileSystem.IRODSConfig.SSLServerName)
+	}
+}
+
+func TestMakeSFTPGoUserCollidingMounts(t *testing.T) {
+	config := newTestUserConfig()
+	config.SFTPGoHomeDir = "/srv/sftpgo/data"
+
+	mountPaths := []types.MountPath{
+		{Name: "user1_home", DirName: "user1", CollectionPath: "/zone/home/user1"},
+		{Name: "user1_project_user1", DirName: "user1", CollectionPath: "/zone/home/shared/user1"},
+		{Name: "user1_project_shared_with_me", DirName: "shared_with_me", CollectionPath: "/zone/home/shared/shared_with_me"},
+		{Name: "user1_shared_with_me_1", DirName: "shared_with_me/user2_a", CollectionPath: "/zone/home/user2/a"},
+		{Name: "user1_project_b", DirName: "b", CollectionPath: "/zone/home/shared/b"},
+	}
+
+	sftpGoUser, err := MakeSFTPGoUser(config, "user1", mountPaths, SFTPGoUserOptions{})
+	if err != nil {
+		t.Fatalf("failed to make a SFTPGo user: %v", err)
+	}
+
+	// later mounts colliding with earlier ones are skipped
+	got := []string{}
+	for _, vfolder := range sftpGoUser.VirtualFolders {
+		got = append(got, vfolder.Name+" "+vfolder.VirtualPath)
+	}
+
+	want := []string{"user1_home /user1", "user1_project_shared_with_me /shared_with_me", "user1_project_b /b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("virtual folders = %q, want %q", got, want)
+	}
+
+	if _, ok := sftpGoUser.Permissions["/shared_with_me/user2_a"]; ok {
+		t.Errorf("skipped mount has permissions: %v", sftpGoUser.Permissions)
+	}
+}
@@ -0,0 +1,67 @@
+package authirods
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+func newAuditRecord(config *commons.Config, method string) *commons.AuditRecord {
+	return &commons.AuditRecord{
+		Time:     time.Now(),
+		Method:   method,
+		Username: config.SFTPGoAuthdUsername,
+		ClientIP: config.SFTPGoAuthdIP,
+		Protocol: config.SFTPGoAuthdProtocol,
+	}
+}
+
+// writeAuditRecord completes the record with the auth result and writes it
+func writeAuditRecord(record *commons.AuditRecord, sftpGoUser *types.SFTPGoUser, err error) {
+	record.LatencyMillis = time.Since(record.Time).Milliseconds()
+
+	if err != nil {
+		record.Result = commons.AuditResultFailure
+		record.Reason = getAuditReason(err)
+		record.Error = err.Error()
+	} else {
+		record.Result = commons.AuditResultSuccess
+		if sftpGoUser != nil {
+			record.SFTPGoUsername = sftpGoUser.Username
+		}
+	}
+
+	err = commons.WriteAuditRecord(record)
+	if err != nil {
+		log.WithError(err).Error("failed to write an audit record")
+	}
+}
+
+func getAuditReason(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return commons.AuditReasonInvalidCredentials
+	case errors.Is(err, auth.ErrKeyNotFound):
+		return commons.AuditReasonKeyNotFound
+	case errors.Is(err, auth.ErrKeyExpired):
+		return commons.AuditReasonKeyExpired
+	case errors.Is(err, auth.ErrKeyNotYetValid):
+		return commons.AuditReasonKeyNotYetValid
+	case errors.Is(err, auth.ErrKeyOutsideTimeWindow):
+		return commons.AuditReasonKeyOutsideTimeWindow
+	case errors.Is(err, auth.ErrClientRejected):
+		return commons.AuditReasonClientRejected
+	case errors.Is(err, auth.ErrLockedOut):
+		return commons.AuditReasonLockedOut
+	case errors.Is(err, auth.ErrProtocolDenied):
+		return commons.AuditReasonProtocolDenied
+	case errors.Is(err, auth.ErrPolicyDenied):
+		return commons.AuditReasonPolicyDenied
+	default:
+		return commons.AuditReasonError
+	}
+}
@@ -0,0 +1,64 @@
+package authirods
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+)
+
+func TestWriteAuditRecordResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantResult string
+		wantReason string
+	}{
+		{"success", nil, commons.AuditResultSuccess, ""},
+		{"invalid credentials", fmt.Errorf("%w: wrong password", auth.ErrInvalidCredentials), commons.AuditResultFailure, commons.AuditReasonInvalidCredentials},
+		{"key not found", fmt.Errorf("no key: %w", auth.ErrKeyNotFound), commons.AuditResultFailure, commons.AuditReasonKeyNotFound},
+		{"key expired", auth.ErrKeyExpired, commons.AuditResultFailure, commons.AuditReasonKeyExpired},
+		{"key not yet valid", auth.ErrKeyNotYetValid, commons.AuditResultFailure, commons.AuditReasonKeyNotYetValid},
+		{"key outside time window", auth.ErrKeyOutsideTimeWindow, commons.AuditResultFailure, commons.AuditReasonKeyOutsideTimeWindow},
+		{"client rejected", auth.ErrClientRejected, commons.AuditResultFailure, commons.AuditReasonClientRejected},
+		{"locked out", auth.ErrLockedOut, commons.AuditResultFailure, commons.AuditReasonLockedOut},
+		{"protocol denied", auth.ErrProtocolDenied, commons.AuditResultFailure, commons.AuditReasonProtocolDenied},
+		{"policy denied", auth.ErrPolicyDenied, commons.AuditResultFailure, commons.AuditReasonPolicyDenied},
+		{"other error", errors.New("connection refused"), commons.AuditResultFailure, commons.AuditReasonError},
+	}
+
+	config := &commons.Config{
+		SFTPGoAuthdUsername: "user1",
+		SFTPGoAuthdIP:       "192.0.2.1",
+		SFTPGoAuthdProtocol: "SSH",
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			record := newAuditRecord(config, commons.AuditMethodPassword)
+
+			var sftpGoUser *types.SFTPGoUser
+			if test.err == nil {
+				sftpGoUser = &types.SFTPGoUser{Username: "user1"}
+			}
+
+			writeAuditRecord(record, sftpGoUser, test.err)
+
+			if record.Result != test.wantResult || record.Reason != test.wantReason {
+				t.Errorf("result = %q, reason = %q, want %q, %q", record.Result, record.Reason, test.wantResult, test.wantReason)
+			}
+			if record.Username != "user1" || record.ClientIP != "192.0.2.1" || record.Protocol != "SSH" || record.Method != commons.AuditMethodPassword {
+				t.Errorf("record = %+v", record)
+			}
+			if test.err == nil && record.SFTPGoUsername != "user1" {
+				t.Errorf("SFTPGo user name = %q", record.SFTPGoUsername)
+			}
+			if test.err != nil && record.Error != test.err.Error() {
+				t.Errorf("error = %q, want %q", record.Error, test.err.Error())
+			}
+		})
+	}
+}
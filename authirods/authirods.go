@@ -0,0 +1,122 @@
+// Package authirods authenticates SFTPGo users against iRODS and builds SFTPGo user definitions.
+package authirods
+
+import (
+	"context"
+
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+)
+
+// Request is an authentication request
+type Request struct {
+	Username  string
+	Password  string
+	PublicKey string
+	IP        string
+	Protocol  string
+	// KeyboardInteractive is set for keyboard interactive auth, credentials are checked by AuthenticateKeyboardInteractive
+	KeyboardInteractive bool
+}
+
+// KeyboardInteractiveRequest is a step of keyboard interactive auth
+type KeyboardInteractiveRequest struct {
+	Username string
+	IP       string
+	// Answers are empty in the first step
+	Answers []string
+}
+
+// Authenticator authenticates requests against iRODS
+type Authenticator struct {
+	config *commons.Config
+}
+
+// NewAuthenticator returns a new Authenticator that uses deployment settings in config
+func NewAuthenticator(config *commons.Config) *Authenticator {
+	return &Authenticator{
+		config: config,
+	}
+}
+
+// makeRequestConfig returns a copy of config filled with request values, as auth flows update it
+func (authenticator *Authenticator) makeRequestConfig(request Request) (*commons.Config, error) {
+	config := *authenticator.config
+	config.SFTPGoAuthdUsername = request.Username
+	config.SFTPGoAuthdPassword = request.Password
+	config.SFTPGoAuthdPublickey = request.PublicKey
+	config.SFTPGoAuthdIP = request.IP
+	config.SFTPGoAuthdProtocol = request.Protocol
+	config.SFTPGoAuthdKeyboardInteractive = ""
+	if request.KeyboardInteractive {
+		config.SFTPGoAuthdKeyboardInteractive = "1"
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Authenticate authenticates a request and returns a SFTPGoUser for the user
+// Requests to iRODS and key sources stop when ctx is done, iRODS timeouts are shortened to its deadline
+func (authenticator *Authenticator) Authenticate(ctx context.Context, request Request) (*types.SFTPGoUser, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := authenticator.makeRequestConfig(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.IsKeyboardInteractiveAuth() {
+		return authKeyboardInteractiveUser(ctx, config)
+	}
+
+	if config.IsPublicKeyAuth() {
+		return authPublicKey(ctx, config)
+	}
+	return authPassword(ctx, config)
+}
+
+// AuthenticateKeyboardInteractive runs a step of keyboard interactive auth and returns a response for SFTPGo
+func (authenticator *Authenticator) AuthenticateKeyboardInteractive(ctx context.Context, request KeyboardInteractiveRequest) (*types.SFTPGoKeyboardInteractiveResponse, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := authenticator.makeRequestConfig(Request{
+		Username:            request.Username,
+		IP:                  request.IP,
+		Protocol:            keyboardInteractiveProtocol,
+		KeyboardInteractive: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return authKeyboardInteractive(ctx, config, request.Answers)
+}
+
+// AuthenticateFake returns a SFTPGoUser for the request without checking credentials, for testing
+func (authenticator *Authenticator) AuthenticateFake(ctx context.Context, request Request) (*types.SFTPGoUser, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := authenticator.makeRequestConfig(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.IsPublicKeyAuth() {
+		return authPublicKeyFake(config)
+	}
+	return authPasswordFake(config)
+}
@@ -0,0 +1,172 @@
+package authirods
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	keyboardInteractivePasswordQuestion string = "Password: "
+	keyboardInteractiveOTPQuestion      string = "One-time code: "
+	// SFTPGo only has keyboard interactive auth for SSH and does not give a protocol to the hook
+	keyboardInteractiveProtocol string = "SSH"
+
+	keyboardInteractiveAuthSuccess  int = 1
+	keyboardInteractiveAuthContinue int = 0
+	keyboardInteractiveAuthFailure  int = -1
+)
+
+// authKeyboardInteractiveUser returns a SFTPGoUser for external auth of keyboard interactive auth.
+// SFTPGo does not give credentials to external auth in this case, they are checked by the keyboard interactive hook later.
+func authKeyboardInteractiveUser(ctx context.Context, config *commons.Config) (sftpGoUser *types.SFTPGoUser, err error) {
+	err = config.ValidateForKeyboardInteractiveAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	auditRecord := newAuditRecord(config, commons.AuditMethodKeyboardInteractive)
+	defer func() {
+		writeAuditRecord(auditRecord, sftpGoUser, err)
+	}()
+
+	allowedProtocols := auth.GetAllowedProtocols(config, nil)
+	err = auth.CheckProtocol(config, allowedProtocols)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auth.CheckLockout(config)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := auth.NewIRODSCatalogClient(ctx, config)
+	defer catalog.Close()
+
+	// the user must exist, as SFTPGo creates the user from the response
+	_, err = catalog.GetUserType(config.SFTPGoAuthdUsername)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the user '%s': %w", config.SFTPGoAuthdUsername, err)
+	}
+
+	err = auth.CheckAccessPolicy(config, catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	userOptions := auth.SFTPGoUserOptions{
+		AllowedProtocols: allowedProtocols,
+	}
+
+	err = applyGroupPolicy(config, catalog, &userOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	mountPaths, err := makeMountPaths(config, &mountRequest{
+		authMethod: commons.AuditMethodKeyboardInteractive,
+		homePath:   config.GetHomeDirPath(),
+		catalog:    catalog,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Found user '%s' for keyboard interactive auth, creating a SFTPGoUser", config.SFTPGoAuthdUsername)
+
+	// connected by the queries above
+	userOptions.Host = catalog.GetHost()
+
+	return auth.MakeSFTPGoUser(config, config.SFTPGoAuthdUsername, mountPaths, userOptions)
+}
+
+// authKeyboardInteractive runs a step of SFTPGo's keyboard interactive hook.
+// Without answers, it asks password and one-time code. With answers, it checks them and returns the auth result.
+func authKeyboardInteractive(ctx context.Context, config *commons.Config, answers []string) (*types.SFTPGoKeyboardInteractiveResponse, error) {
+	err := config.ValidateForKeyboardInteractiveAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(answers) == 0 {
+		return &types.SFTPGoKeyboardInteractiveResponse{
+			Questions:  []string{keyboardInteractivePasswordQuestion, keyboardInteractiveOTPQuestion},
+			Echos:      []bool{false, false},
+			AuthResult: keyboardInteractiveAuthContinue,
+		}, nil
+	}
+
+	err = checkKeyboardInteractiveAnswers(ctx, config, answers)
+	if err != nil {
+		log.WithError(err).Errorf("Authenticated failed for user '%s' using keyboard interactive", config.SFTPGoAuthdUsername)
+		return &types.SFTPGoKeyboardInteractiveResponse{
+			AuthResult: keyboardInteractiveAuthFailure,
+		}, err
+	}
+
+	log.Infof("Authenticated user '%s' using keyboard interactive", config.SFTPGoAuthdUsername)
+	return &types.SFTPGoKeyboardInteractiveResponse{
+		AuthResult: keyboardInteractiveAuthSuccess,
+	}, nil
+}
+
+// checkKeyboardInteractiveAnswers checks password and one-time code, every result is audited
+func checkKeyboardInteractiveAnswers(ctx context.Context, config *commons.Config, answers []string) (err error) {
+	auditRecord := newAuditRecord(config, commons.AuditMethodKeyboardInteractive)
+	defer func() {
+		if err == nil {
+			auditRecord.SFTPGoUsername = config.SFTPGoAuthdUsername
+		}
+		writeAuditRecord(auditRecord, nil, err)
+	}()
+
+	if len(answers) != 2 {
+		return fmt.Errorf("expected 2 answers for keyboard interactive auth, but got %d", len(answers))
+	}
+
+	err = auth.CheckProtocol(config, auth.GetAllowedProtocols(config, nil))
+	if err != nil {
+		return err
+	}
+
+	err = auth.CheckLockout(config)
+	if err != nil {
+		return err
+	}
+
+	// PAM stack checks password and one-time code in a single round
+	config.SFTPGoAuthdPassword = answers[0] + config.IRODSPAMOTPSeparator + answers[1]
+	// SFTPGo gets proxy credentials from external auth, a session token would not be used
+	config.IRODSPAMSessionToken = false
+
+	catalog := auth.NewIRODSCatalogClient(ctx, config)
+	defer catalog.Close()
+
+	loggedIn, _, _, err := authViaPassword(ctx, config, catalog)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			auth.RecordAuthFailure(config)
+		}
+		return err
+	}
+
+	if !loggedIn {
+		return fmt.Errorf("unable to auth the user %s: %w", config.SFTPGoAuthdUsername, auth.ErrInvalidCredentials)
+	}
+
+	// .ssh dir is created on the login, as password auth does
+	err = auth.CheckAccessPolicy(config, catalog)
+	if err != nil {
+		return err
+	}
+
+	// denied users keep their failures
+	auth.RecordAuthSuccess(config)
+	return nil
+}
@@ -0,0 +1,202 @@
+package authirods
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+func newTestKeyboardInteractiveConfig(t *testing.T) *commons.Config {
+	return &commons.Config{
+		IRODSZone:                      "zone",
+		IRODSAuthScheme:                "pam",
+		IRODSPAMOTPSeparator:           ":",
+		IRODSPAMSessionToken:           true,
+		IRODSProxyUsername:             "proxy",
+		IRODSProxyPassword:             "proxy_password",
+		LockoutDir:                     t.TempDir(),
+		LockoutThreshold:               2,
+		LockoutDuration:                60,
+		LockoutMaxDuration:             3600,
+		SFTPGoAuthdUsername:            "user1",
+		SFTPGoAuthdIP:                  "192.0.2.1",
+		SFTPGoAuthdProtocol:            keyboardInteractiveProtocol,
+		SFTPGoAuthdKeyboardInteractive: "1",
+	}
+}
+
+// setTestAuthViaPassword replaces password auth with a fake rejecting all passwords, and returns the passwords checked
+func setTestAuthViaPassword(t *testing.T) *[]string {
+	passwords := []string{}
+
+	original := authViaPassword
+	authViaPassword = func(ctx context.Context, config *commons.Config, catalog *auth.IRODSCatalogClient) (bool, string, string, error) {
+		if config.IRODSPAMSessionToken {
+			t.Errorf("PAM session token is requested in keyboard interactive auth")
+		}
+		passwords = append(passwords, config.SFTPGoAuthdPassword)
+		return false, "", "", fmt.Errorf("%w: wrong password", auth.ErrInvalidCredentials)
+	}
+	t.Cleanup(func() {
+		authViaPassword = original
+	})
+
+	return &passwords
+}
+
+func TestAuthKeyboardInteractiveQuestions(t *testing.T) {
+	passwords := setTestAuthViaPassword(t)
+
+	response, err := authKeyboardInteractive(context.Background(), newTestKeyboardInteractiveConfig(t), nil)
+	if err != nil {
+		t.Fatalf("failed to ask questions: %v", err)
+	}
+
+	wantQuestions := []string{keyboardInteractivePasswordQuestion, keyboardInteractiveOTPQuestion}
+	if !reflect.DeepEqual(response.Questions, wantQuestions) {
+		t.Errorf("questions = %q, want %q", response.Questions, wantQuestions)
+	}
+	if !reflect.DeepEqual(response.Echos, []bool{false, false}) {
+		t.Errorf("answers are echoed: %v", response.Echos)
+	}
+	if response.AuthResult != keyboardInteractiveAuthContinue {
+		t.Errorf("auth result = %d, want %d", response.AuthResult, keyboardInteractiveAuthContinue)
+	}
+	if len(*passwords) != 0 {
+		t.Errorf("password is checked before answers are given")
+	}
+}
+
+func TestAuthKeyboardInteractiveAnswers(t *testing.T) {
+	tests := []struct {
+		name          string
+		answers       []string
+		wantPasswords []string
+		wantErr       error
+	}{
+		{"password and one-time code", []string{"password", "123456"}, []string{"password:123456"}, auth.ErrInvalidCredentials},
+		{"too few answers", []string{"password"}, []string{}, nil},
+		{"too many answers", []string{"password", "123456", "extra"}, []string{}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			passwords := setTestAuthViaPassword(t)
+
+			response, err := authKeyboardInteractive(context.Background(), newTestKeyboardInteractiveConfig(t), test.answers)
+			if err == nil {
+				t.Fatal("wrong answers are accepted")
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("err = %v, want %v", err, test.wantErr)
+			}
+			if response == nil || response.AuthResult != keyboardInteractiveAuthFailure {
+				t.Errorf("response = %+v, want auth failure", response)
+			}
+			if !reflect.DeepEqual(*passwords, test.wantPasswords) {
+				t.Errorf("passwords checked = %q, want %q", *passwords, test.wantPasswords)
+			}
+		})
+	}
+}
+
+func TestAuthKeyboardInteractiveLockout(t *testing.T) {
+	passwords := setTestAuthViaPassword(t)
+	config := newTestKeyboardInteractiveConfig(t)
+
+	for i := 0; i < config.LockoutThreshold; i++ {
+		requestConfig := *config
+		_, err := authKeyboardInteractive(context.Background(), &requestConfig, []string{"password", "123456"})
+		if !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: err = %v, want invalid credentials", i+1, err)
+		}
+	}
+
+	// locked out without checking the password
+	requestConfig := *config
+	response, err := authKeyboardInteractive(context.Background(), &requestConfig, []string{"password", "123456"})
+	if !errors.Is(err, auth.ErrLockedOut) {
+		t.Errorf("err = %v, want locked out", err)
+	}
+	if response.AuthResult != keyboardInteractiveAuthFailure {
+		t.Errorf("auth result = %d, want %d", response.AuthResult, keyboardInteractiveAuthFailure)
+	}
+	if len(*passwords) != config.LockoutThreshold {
+		t.Errorf("password is checked %d times, want %d", len(*passwords), config.LockoutThreshold)
+	}
+}
+
+func TestAuthKeyboardInteractiveUserAuditsDenial(t *testing.T) {
+	logDir := t.TempDir()
+	commons.SetAuditLog(logDir)
+
+	config := newTestKeyboardInteractiveConfig(t)
+	config.SFTPGoAllowedProtocols = []string{"FTP"}
+
+	_, err := authKeyboardInteractiveUser(context.Background(), config)
+	if !errors.Is(err, auth.ErrProtocolDenied) {
+		t.Fatalf("err = %v, want protocol denied", err)
+	}
+
+	auditLog, err := os.ReadFile(filepath.Join(logDir, "sftpgo_auth_irods_audit.log"))
+	if err != nil {
+		t.Fatalf("failed to read the audit log: %v", err)
+	}
+
+	record := commons.AuditRecord{}
+	err = json.Unmarshal(auditLog, &record)
+	if err != nil {
+		t.Fatalf("failed to parse the audit record %q: %v", auditLog, err)
+	}
+	if record.Method != commons.AuditMethodKeyboardInteractive || record.Result != commons.AuditResultFailure || record.Reason != commons.AuditReasonProtocolDenied {
+		t.Errorf("audit record = %+v, want a protocol denial of keyboard interactive auth", record)
+	}
+}
+
+func TestAuthKeyboardInteractiveDeniedKeepsFailures(t *testing.T) {
+	original := authViaPassword
+	authViaPassword = func(ctx context.Context, config *commons.Config, catalog *auth.IRODSCatalogClient) (bool, string, string, error) {
+		if config.SFTPGoAuthdPassword != "password:123456" {
+			return false, "", "", fmt.Errorf("%w: wrong password", auth.ErrInvalidCredentials)
+		}
+		return true, "", "", nil
+	}
+	t.Cleanup(func() {
+		authViaPassword = original
+	})
+
+	config := newTestKeyboardInteractiveConfig(t)
+	config.SFTPGoDeniedUserTypes = []string{"rodsadmin"}
+	// only failures of the user count, those of the client IP are not cleared by a success
+	config.SFTPGoAuthdIP = ""
+
+	// the canceled context fails the access policy check, which looks up the user type
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	steps := []struct {
+		answers []string
+		wantErr error
+	}{
+		{[]string{"password", "000000"}, auth.ErrInvalidCredentials},
+		{[]string{"password", "123456"}, context.Canceled},
+		{[]string{"password", "000000"}, auth.ErrInvalidCredentials},
+		{[]string{"password", "123456"}, auth.ErrLockedOut},
+	}
+
+	for i, step := range steps {
+		requestConfig := *config
+		_, err := authKeyboardInteractive(ctx, &requestConfig, step.answers)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("attempt %d: err = %v, want %v", i+1, err, step.wantErr)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package authirods
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sharedWithMeDirName string = "shared_with_me"
+)
+
+// invalidNameCharsRegexp matches chars that are not allowed in names, see commons.IsValidName
+var invalidNameCharsRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// mountRequest has values of a login to make mounts from mount templates
+type mountRequest struct {
+	authMethod string
+	// homePath is the home collection, a custom home for per-key users
+	homePath string
+	// pubKeyName is given for per-key users to make virtual folder names unique
+	pubKeyName string
+	// catalog is nil if iRODS is not available, such as fake auth
+	catalog auth.CatalogClient
+
+	groups     []string
+	groupsRead bool
+}
+
+// getGroups returns groups of the user, read once on demand
+func (request *mountRequest) getGroups(config *commons.Config) ([]string, error) {
+	if request.groupsRead {
+		return request.groups, nil
+	}
+
+	request.groups = []string{}
+	if !config.IsAnonymousUser() && request.catalog != nil {
+		groups, err := request.catalog.ListUserGroups(config.SFTPGoAuthdUsername)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list groups of the user '%s': %w", config.SFTPGoAuthdUsername, err)
+		}
+		request.groups = groups
+	}
+
+	request.groupsRead = true
+	return request.groups, nil
+}
+
+func makeMountPathForSSHDir(config *commons.Config) types.MountPath {
+	userHomePath := config.GetHomeDirPath()
+	return types.MountPath{
+		Name:           fmt.Sprintf("%s_ssh", config.SFTPGoAuthdUsername),
+		DirName:        ".ssh",
+		Description:    "iRODS .ssh dir",
+		CollectionPath: fmt.Sprintf("%s/.ssh", userHomePath),
+	}
+}
+
+// makeDefaultMountTemplates returns templates of the home and the shared mounts
+func makeDefaultMountTemplates(config *commons.Config, request *mountRequest) []commons.MountConfig {
+	homeDescription := "iRODS home"
+	if request.homePath != config.GetHomeDirPath() {
+		homeDescription = fmt.Sprintf("iRODS home - %s", request.homePath)
+	}
+
+	templates := []commons.MountConfig{
+		{
+			Name:           "home",
+			DirName:        config.SFTPGoAuthdUsername,
+			Description:    homeDescription,
+			CollectionPath: request.homePath,
+			When: commons.MountCondition{
+				Users: commons.MountUsersAuthenticated,
+			},
+		},
+	}
+
+	if config.HasSharedDir() {
+		sharedDirName := config.GetSharedDirName()
+		templates = append(templates, commons.MountConfig{
+			Name:           sharedDirName,
+			DirName:        sharedDirName,
+			Description:    fmt.Sprintf("iRODS %s", sharedDirName),
+			CollectionPath: config.IRODSShared,
+			When: commons.MountCondition{
+				Users: commons.MountUsersAll,
+			},
+		})
+	}
+
+	return templates
+}
+
+// makeMountPaths returns mount paths of the default and configured mount templates matching the login
+func makeMountPaths(config *commons.Config, request *mountRequest) ([]types.MountPath, error) {
+	templates := []commons.MountConfig{}
+	if !config.DisableDefaultMounts {
+		templates = append(templates, makeDefaultMountTemplates(config, request)...)
+	}
+	if config.ProjectMounts {
+		templates = append(templates, config.GetProjectMountTemplate())
+	}
+	templates = append(templates, config.Mounts...)
+
+	values := commons.MountValues{
+		Zone: config.IRODSZone,
+		User: config.SFTPGoAuthdUsername,
+		Home: request.homePath,
+	}
+
+	mountPaths := []types.MountPath{}
+	for _, template := range templates {
+		matched, err := matchMountCondition(config, request, &template.When)
+		if err != nil {
+			return nil, err
+		}
+
+		if !matched {
+			continue
+		}
+
+		if !template.HasGroupPlaceholder() {
+			mount := template.Expand(values)
+			exists, err := checkMountCollection(request, &mount)
+			if err != nil {
+				return nil, err
+			}
+
+			if exists {
+				mountPaths = append(mountPaths, makeMountPath(config, request, mount))
+			}
+			continue
+		}
+
+		groups, err := request.getGroups(config)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range groups {
+			if len(template.When.Groups) > 0 && !slices.Contains(template.When.Groups, group) {
+				continue
+			}
+
+			groupValues := values
+			groupValues.Group = group
+
+			mount := template.Expand(groupValues)
+			err = mount.Validate()
+			if err != nil {
+				log.Warnf("skipping mount %q for the group '%s': %v", template.Name, group, err)
+				continue
+			}
+
+			exists, err := checkMountCollection(request, &mount)
+			if err != nil {
+				return nil, err
+			}
+
+			if exists {
+				mountPaths = append(mountPaths, makeMountPath(config, request, mount))
+			}
+		}
+	}
+
+	if config.SharedWithMe && !config.IsAnonymousUser() && request.catalog != nil {
+		sharedMountPaths, err := makeSharedWithMeMountPaths(config, request, mountPaths)
+		if err != nil {
+			return nil, err
+		}
+		mountPaths = append(mountPaths, sharedMountPaths...)
+	}
+
+	if !config.DisableACLPermissions && request.catalog != nil {
+		err := setACLPermissions(config, request, mountPaths)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mountPaths, nil
+}
+
+// setACLPermissions limits permissions on the mount paths to the user's access to their collections
+func setACLPermissions(config *commons.Config, request *mountRequest, mountPaths []types.MountPath) error {
+	for i := range mountPaths {
+		if mountPaths[i].Permissions != nil {
+			continue
+		}
+
+		access, err := request.catalog.GetCollectionAccess(config.SFTPGoAuthdUsername, mountPaths[i].CollectionPath)
+		if err != nil {
+			return fmt.Errorf("failed to get access of the user '%s' to collection %q: %w", config.SFTPGoAuthdUsername, mountPaths[i].CollectionPath, err)
+		}
+
+		mountPaths[i].Permissions = auth.GetCollectionPermissions(access)
+		log.Debugf("granting %s on collection %q by ACLs", strings.Join(mountPaths[i].Permissions, ","), mountPaths[i].CollectionPath)
+	}
+	return nil
+}
+
+// makeSharedWithMeMountPaths returns mount paths of collections shared with the user, under the shared_with_me dir
+// Collections already reachable via other mounts or via shared collections above them are not mounted,
+// unless the user has more access to them than to the shared collections above them
+// Collections are read-only unless the user can write to them
+func makeSharedWithMeMountPaths(config *commons.Config, request *mountRequest, mountPaths []types.MountPath) ([]types.MountPath, error) {
+	sharedCollections, err := request.catalog.ListSharedCollections(config.SFTPGoAuthdUsername)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections shared with the user '%s': %w", config.SFTPGoAuthdUsername, err)
+	}
+
+	mountedPaths := []string{}
+	for _, mountPath := range mountPaths {
+		mountedPaths = append(mountedPaths, mountPath.CollectionPath)
+	}
+
+	// accesses of mounted shared collections, to mount collections under them having more access
+	sharedAccesses := map[string]auth.CollectionAccess{}
+
+	homeRootPath := path.Join("/", config.IRODSZone, "home")
+
+	sharedMountPaths := []types.MountPath{}
+	skipped := 0
+	for _, sharedCollection := range sharedCollections {
+		if isSharedCollectionMounted(sharedCollection, mountedPaths, sharedAccesses) {
+			continue
+		}
+
+		if len(sharedMountPaths) >= config.SharedWithMeMaxMounts {
+			skipped++
+			continue
+		}
+
+		hash := sha256.Sum256([]byte(sharedCollection.Path))
+		hashName := hex.EncodeToString(hash[:6])
+
+		dirName := strings.TrimPrefix(sharedCollection.Path, "/")
+		if commons.IsPathUnder(sharedCollection.Path, homeRootPath) {
+			dirName = strings.TrimPrefix(sharedCollection.Path, homeRootPath+"/")
+		}
+
+		mountPath := makeMountPath(config, request, commons.MountConfig{
+			Name:           fmt.Sprintf("%s_%s", sharedWithMeDirName, hashName),
+			DirName:        path.Join(sharedWithMeDirName, makeSharedWithMeDirName(dirName, hashName)),
+			Description:    fmt.Sprintf("iRODS shared with me - %s", sharedCollection.Path),
+			CollectionPath: sharedCollection.Path,
+		})
+		// access is known already, not to query again for ACL permissions
+		mountPath.Permissions = auth.GetCollectionPermissions(sharedCollection.Access)
+
+		sharedMountPaths = append(sharedMountPaths, mountPath)
+		mountedPaths = append(mountedPaths, sharedCollection.Path)
+		sharedAccesses[sharedCollection.Path] = sharedCollection.Access
+	}
+
+	if skipped > 0 {
+		log.Warnf("skipping %d collections shared with the user '%s', exceeding max %d mounts", skipped, config.SFTPGoAuthdUsername, config.SharedWithMeMaxMounts)
+	}
+	return sharedMountPaths, nil
+}
+
+// isSharedCollectionMounted checks if the shared collection is reachable via a mounted collection above it
+// with the same or more access. Access via mounts other than shared collections is not known, so they always count.
+func isSharedCollectionMounted(sharedCollection auth.SharedCollection, mountedPaths []string, sharedAccesses map[string]auth.CollectionAccess) bool {
+	for _, mountedPath := range mountedPaths {
+		if !commons.IsPathUnder(sharedCollection.Path, mountedPath) {
+			continue
+		}
+
+		access, ok := sharedAccesses[mountedPath]
+		if !ok || access >= sharedCollection.Access {
+			return true
+		}
+	}
+	return false
+}
+
+// makeSharedWithMeDirName returns a valid dir name under the shared_with_me dir for the relative collection path
+// Slashes and other chars not allowed in names are replaced by '_', the hash name is used if no valid name is left
+func makeSharedWithMeDirName(relPath string, hashName string) string {
+	dirName := invalidNameCharsRegexp.ReplaceAllString(relPath, "_")
+	dirName = strings.TrimLeft(dirName, "._-")
+	if len(dirName) > 64 {
+		dirName = dirName[:64]
+	}
+
+	if !commons.IsValidName(dirName) {
+		return hashName
+	}
+	return dirName
+}
+
+// checkMountCollection checks if the collection of the expanded mount template exists, when the template requires
+// Collections are regarded as not existing if iRODS is not available
+func checkMountCollection(request *mountRequest, mount *commons.MountConfig) (bool, error) {
+	if !mount.RequireCollection {
+		return true, nil
+	}
+
+	if request.catalog == nil {
+		return false, nil
+	}
+
+	exists, err := request.catalog.CollectionExists(mount.CollectionPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to check collection %q of mount %q: %w", mount.CollectionPath, mount.Name, err)
+	}
+
+	if !exists {
+		log.Debugf("skipping mount %q as collection %q does not exist", mount.Name, mount.CollectionPath)
+	}
+	return exists, nil
+}
+
+// makeMountPath returns a mount path for the expanded mount template
+func makeMountPath(config *commons.Config, request *mountRequest, mount commons.MountConfig) types.MountPath {
+	name := fmt.Sprintf("%s_%s", config.SFTPGoAuthdUsername, mount.Name)
+	if len(request.pubKeyName) > 0 {
+		name = fmt.Sprintf("%s_%s", name, request.pubKeyName)
+	}
+
+	description := mount.Description
+	if len(description) == 0 {
+		description = fmt.Sprintf("iRODS %s", mount.CollectionPath)
+	}
+
+	return types.MountPath{
+		Name:           name,
+		DirName:        mount.DirName,
+		Description:    description,
+		CollectionPath: mount.CollectionPath,
+	}
+}
+
+// matchMountCondition checks if the login matches all given fields of the condition
+func matchMountCondition(config *commons.Config, request *mountRequest, condition *commons.MountCondition) (bool, error) {
+	switch strings.ToLower(condition.Users) {
+	case "", commons.MountUsersAuthenticated:
+		if config.IsAnonymousUser() {
+			return false, nil
+		}
+	case commons.MountUsersAnonymous:
+		if !config.IsAnonymousUser() {
+			return false, nil
+		}
+	case commons.MountUsersAll:
+	default:
+		return false, nil
+	}
+
+	if len(condition.AuthMethods) > 0 && !containsFold(condition.AuthMethods, request.authMethod) {
+		return false, nil
+	}
+
+	if len(condition.Protocols) > 0 && !containsFold(condition.Protocols, config.SFTPGoAuthdProtocol) {
+		return false, nil
+	}
+
+	if len(condition.Groups) > 0 {
+		groups, err := request.getGroups(config)
+		if err != nil {
+			return false, err
+		}
+
+		member := false
+		for _, group := range groups {
+			if slices.Contains(condition.Groups, group) {
+				member = true
+				break
+			}
+		}
+
+		if !member {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
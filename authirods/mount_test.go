@@ -0,0 +1,368 @@
+package authirods
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+)
+
+// fakeCatalog is a CatalogClient of static results
+type fakeCatalog struct {
+	groups []string
+	// collections are existing collections, all collections exist if nil
+	collections       map[string]bool
+	sharedCollections []auth.SharedCollection
+	accesses          map[string]auth.CollectionAccess
+}
+
+func (catalog *fakeCatalog) GetUserType(username string) (string, error) {
+	return "rodsuser", nil
+}
+
+func (catalog *fakeCatalog) ListUserGroups(username string) ([]string, error) {
+	return catalog.groups, nil
+}
+
+func (catalog *fakeCatalog) CollectionExists(collectionPath string) (bool, error) {
+	if catalog.collections == nil {
+		return true, nil
+	}
+	return catalog.collections[collectionPath], nil
+}
+
+func (catalog *fakeCatalog) ListSharedCollections(username string) ([]auth.SharedCollection, error) {
+	return catalog.sharedCollections, nil
+}
+
+func (catalog *fakeCatalog) GetCollectionAccess(username string, collectionPath string) (auth.CollectionAccess, error) {
+	return catalog.accesses[collectionPath], nil
+}
+
+func newTestMountConfig() *commons.Config {
+	return &commons.Config{
+		IRODSZone:           "zone",
+		IRODSShared:         "/zone/home/shared",
+		SFTPGoAuthdUsername: "user1",
+		SFTPGoAuthdProtocol: "SSH",
+	}
+}
+
+// describeMountPaths returns "name dir_name collection_path" of the mount paths
+func describeMountPaths(mountPaths []types.MountPath) []string {
+	descriptions := []string{}
+	for _, mountPath := range mountPaths {
+		descriptions = append(descriptions, fmt.Sprintf("%s %s %s", mountPath.Name, mountPath.DirName, mountPath.CollectionPath))
+	}
+	return descriptions
+}
+
+func TestMakeMountPaths(t *testing.T) {
+	groupMount := commons.MountConfig{
+		Name:           "lab_{group}",
+		DirName:        "{group}",
+		CollectionPath: "/{zone}/labs/{group}",
+		When: commons.MountCondition{
+			Groups: []string{"a", "c", "x/y"},
+		},
+	}
+	davMount := commons.MountConfig{
+		Name:           "dav",
+		DirName:        "dav",
+		CollectionPath: "{home}/dav",
+		When: commons.MountCondition{
+			Protocols: []string{"dav"},
+		},
+	}
+	keyMount := commons.MountConfig{
+		Name:           "keys",
+		DirName:        "keys",
+		CollectionPath: "/{zone}/keys/{user}",
+		When: commons.MountCondition{
+			AuthMethods: []string{"publickey"},
+		},
+	}
+	anonymousMount := commons.MountConfig{
+		Name:           "public",
+		DirName:        "public",
+		CollectionPath: "/{zone}/public",
+		When: commons.MountCondition{
+			Users: commons.MountUsersAnonymous,
+		},
+	}
+	requiredMount := commons.MountConfig{
+		Name:              "scratch",
+		DirName:           "scratch",
+		CollectionPath:    "/{zone}/scratch/{user}",
+		RequireCollection: true,
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(config *commons.Config)
+		request mountRequest
+		want    []string
+	}{
+		{
+			"default mounts",
+			nil,
+			mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: &fakeCatalog{}},
+			[]string{"user1_home user1 /zone/home/user1", "user1_shared shared /zone/home/shared"},
+		},
+		{
+			"custom home and key name",
+			nil,
+			mountRequest{authMethod: "publickey", homePath: "/zone/home/user1/laptop", pubKeyName: "laptop", catalog: &fakeCatalog{}},
+			[]string{"user1_home_laptop user1 /zone/home/user1/laptop", "user1_shared_laptop shared /zone/home/shared"},
+		},
+		{
+			"anonymous",
+			func(config *commons.Config) {
+				config.SFTPGoAuthdUsername = "anonymous"
+				config.Mounts = []commons.MountConfig{anonymousMount, groupMount}
+			},
+			mountRequest{authMethod: "password", catalog: &fakeCatalog{groups: []string{"a"}}},
+			[]string{"anonymous_shared shared /zone/home/shared", "anonymous_public public /zone/public"},
+		},
+		{
+			"group mounts of matching groups",
+			func(config *commons.Config) {
+				config.DisableDefaultMounts = true
+				config.Mounts = []commons.MountConfig{groupMount}
+			},
+			mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: &fakeCatalog{groups: []string{"a", "b", "x/y", "public"}}},
+			[]string{"user1_lab_a a /zone/labs/a"},
+		},
+		{
+			"protocol condition not matching",
+			func(config *commons.Config) {
+				config.DisableDefaultMounts = true
+				config.Mounts = []commons.MountConfig{davMount}
+			},
+			mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: &fakeCatalog{}},
+			[]string{},
+		},
+		{
+			"protocol condition",
+			func(config *commons.Config) {
+				config.DisableDefaultMounts = true
+				config.SFTPGoAuthdProtocol = "DAV"
+				config.Mounts = []commons.MountConfig{davMount}
+			},
+			mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: &fakeCatalog{}},
+			[]string{"user1_dav dav /zone/home/user1/dav"},
+		},
+		{
+			"auth method condition",
+			func(config *commons.Config) {
+				config.DisableDefaultMounts = true
+				config.Mounts = []commons.MountConfig{keyMount}
+			},
+			mountRequest{authMethod: "publickey", homePath: "/zone/home/user1", catalog: &fakeCatalog{}},
+			[]string{"user1_keys keys /zone/keys/user1"},
+		},
+		{
+			"auth method condition not matching",
+			func(config *commons.Config) {
+				config.DisableDefaultMounts = true
+				config.Mounts = []commons.MountConfig{keyMount}
+			},
+			mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: &fakeCatalog{}},
+			[]string{},
+		},
+		{
+			"project mounts of existing collections",
+			func(config *commons.Config) {
+				config.DisableDefaultMounts = true
+				config.ProjectMounts = true
+				config.ProjectCollectionPath = "/{zone}/home/shared/{group}"
+			},
+			mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: &fakeCatalog{groups: []string{"a", "b"}, collections: map[string]bool{"/zone/home/shared/b": true}}},
+			[]string{"user1_project_b b /zone/home/shared/b"},
+		},
+		{
+			"required collection without iRODS",
+			func(config *commons.Config) {
+				config.DisableDefaultMounts = true
+				config.Mounts = []commons.MountConfig{requiredMount}
+			},
+			mountRequest{authMethod: "password", homePath: "/zone/home/user1"},
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newTestMountConfig()
+			if test.modify != nil {
+				test.modify(config)
+			}
+
+			request := test.request
+			mountPaths, err := makeMountPaths(config, &request)
+			if err != nil {
+				t.Fatalf("failed to make mount paths: %v", err)
+			}
+
+			got := describeMountPaths(mountPaths)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("mount paths = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMakeSharedWithMeMountPaths(t *testing.T) {
+	config := newTestMountConfig()
+	config.SharedWithMe = true
+	config.SharedWithMeMaxMounts = 2
+
+	catalog := &fakeCatalog{
+		sharedCollections: []auth.SharedCollection{
+			{Path: "/zone/home/shared/project", Access: auth.CollectionAccessWrite},
+			{Path: "/zone/home/user2/a", Access: auth.CollectionAccessRead},
+			{Path: "/zone/home/user2/a/b", Access: auth.CollectionAccessWrite},
+			{Path: "/zone/home/user3/x", Access: auth.CollectionAccessWrite},
+			{Path: "/zone/projects/y", Access: auth.CollectionAccessWrite},
+		},
+	}
+
+	mountPaths, err := makeMountPaths(config, &mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: catalog})
+	if err != nil {
+		t.Fatalf("failed to make mount paths: %v", err)
+	}
+
+	type sharedMount struct {
+		dirName        string
+		collectionPath string
+		permissions    []string
+	}
+
+	got := []sharedMount{}
+	for _, mountPath := range mountPaths[2:] {
+		got = append(got, sharedMount{mountPath.DirName, mountPath.CollectionPath, mountPath.Permissions})
+	}
+
+	// collections under other mounts are skipped, and mounts are limited to the max
+	want := []sharedMount{
+		{"shared_with_me/user2_a", "/zone/home/user2/a", []string{"list", "download"}},
+		{"shared_with_me/user2_a_b", "/zone/home/user2/a/b", []string{"*"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("shared mounts = %+v, want %+v", got, want)
+	}
+
+	anonymousConfig := newTestMountConfig()
+	anonymousConfig.SFTPGoAuthdUsername = "anonymous"
+	anonymousConfig.SharedWithMe = true
+	anonymousConfig.SharedWithMeMaxMounts = 2
+
+	mountPaths, err = makeMountPaths(anonymousConfig, &mountRequest{authMethod: "password", catalog: catalog})
+	if err != nil {
+		t.Fatalf("failed to make mount paths: %v", err)
+	}
+	if len(mountPaths) != 1 {
+		t.Errorf("anonymous user has shared mounts: %q", describeMountPaths(mountPaths))
+	}
+}
+
+func TestMakeSharedWithMeMountPathsNested(t *testing.T) {
+	config := newTestMountConfig()
+	config.SharedWithMe = true
+	config.SharedWithMeMaxMounts = 20
+
+	catalog := &fakeCatalog{
+		sharedCollections: []auth.SharedCollection{
+			{Path: "/zone/home/user2/data", Access: auth.CollectionAccessRead},
+			{Path: "/zone/home/user2/data/in", Access: auth.CollectionAccessWrite},
+			{Path: "/zone/home/user2/data/in/raw", Access: auth.CollectionAccessWrite},
+			{Path: "/zone/home/user2/data/out", Access: auth.CollectionAccessRead},
+		},
+	}
+
+	mountPaths, err := makeMountPaths(config, &mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: catalog})
+	if err != nil {
+		t.Fatalf("failed to make mount paths: %v", err)
+	}
+
+	got := map[string][]string{}
+	for _, mountPath := range mountPaths[2:] {
+		got[mountPath.DirName] = mountPath.Permissions
+	}
+
+	// the child having more access than the parent is mounted, others are reachable via the mounts above them
+	want := map[string][]string{
+		"shared_with_me/user2_data":    {"list", "download"},
+		"shared_with_me/user2_data_in": {"*"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("shared mounts = %v, want %v", got, want)
+	}
+}
+
+func TestMakeSharedWithMeDirName(t *testing.T) {
+	tests := []struct {
+		relPath string
+		want    string
+	}{
+		{"user2/data", "user2_data"},
+		{"user2/my data (1)", "user2_my_data_1_"},
+		{"..", "hash"},
+		{"ユーザー", "hash"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 64)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.relPath, func(t *testing.T) {
+			got := makeSharedWithMeDirName(test.relPath, "hash")
+			if got != test.want {
+				t.Errorf("dir name = %q, want %q", got, test.want)
+			}
+			if !commons.IsValidName(got) {
+				t.Errorf("dir name %q is not valid", got)
+			}
+		})
+	}
+}
+
+func TestMakeMountPathsACLPermissions(t *testing.T) {
+	catalog := &fakeCatalog{
+		accesses: map[string]auth.CollectionAccess{
+			"/zone/home/user1":  auth.CollectionAccessWrite,
+			"/zone/home/shared": auth.CollectionAccessRead,
+		},
+	}
+
+	tests := []struct {
+		name                  string
+		disableACLPermissions bool
+		want                  [][]string
+	}{
+		{"enabled by default", false, [][]string{{"*"}, {"list", "download"}}},
+		{"disabled", true, [][]string{nil, nil}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newTestMountConfig()
+			config.DisableACLPermissions = test.disableACLPermissions
+
+			mountPaths, err := makeMountPaths(config, &mountRequest{authMethod: "password", homePath: "/zone/home/user1", catalog: catalog})
+			if err != nil {
+				t.Fatalf("failed to make mount paths: %v", err)
+			}
+
+			got := [][]string{}
+			for _, mountPath := range mountPaths {
+				got = append(got, mountPath.Permissions)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("permissions = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package authirods
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// authViaPassword checks a password against iRODS, tests replace it not to connect to iRODS
+var authViaPassword = auth.AuthViaPassword
+
+func authPasswordFake(config *commons.Config) (*types.SFTPGoUser, error) {
+	if config.IsAnonymousUser() {
+		// overwrite existing account info to ensure correct spell/case and empty password
+		config.SFTPGoAuthdUsername = "anonymous"
+		config.SFTPGoAuthdPassword = "" // empty password
+	}
+
+	log.Infof("Authenticated user '%s' using password, creating a SFTPGoUser", config.SFTPGoAuthdUsername)
+
+	// anonymous user doesn't have home dir, the home mount template is only for authenticated users
+	mountPaths, err := makeMountPaths(config, &mountRequest{
+		authMethod: getPasswordAuthMethod(config),
+		homePath:   config.GetHomeDirPath(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sftpGoUser, err := auth.MakeSFTPGoUser(config, config.SFTPGoAuthdUsername, mountPaths, auth.SFTPGoUserOptions{
+		AllowedProtocols: auth.GetAllowedProtocols(config, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sftpGoUser, nil
+}
+
+// getPasswordAuthMethod returns the auth method of password auth, used in audit records and mount conditions
+func getPasswordAuthMethod(config *commons.Config) string {
+	if config.IsKeyboardInteractiveAuth() {
+		return commons.AuditMethodKeyboardInteractive
+	}
+	return commons.AuditMethodPassword
+}
+
+func authPassword(ctx context.Context, config *commons.Config) (sftpGoUser *types.SFTPGoUser, err error) {
+	if config.IsAnonymousUser() {
+		// overwrite existing account info to ensure correct spell/case and empty password
+		config.SFTPGoAuthdUsername = "anonymous"
+		config.SFTPGoAuthdPassword = "" // empty password
+	}
+
+	auditMethod := getPasswordAuthMethod(config)
+
+	auditRecord := newAuditRecord(config, auditMethod)
+	defer func() {
+		writeAuditRecord(auditRecord, sftpGoUser, err)
+	}()
+
+	allowedProtocols := auth.GetAllowedProtocols(config, nil)
+	err = auth.CheckProtocol(config, allowedProtocols)
+	if err != nil {
+		log.WithError(err).Errorf("Authenticated failed for user '%s' using password", config.SFTPGoAuthdUsername)
+		return nil, err
+	}
+
+	// reject before connecting to iRODS, not to lock out the account upstream
+	err = auth.CheckLockout(config)
+	if err != nil {
+		log.WithError(err).Errorf("Authenticated failed for user '%s' using password", config.SFTPGoAuthdUsername)
+		return nil, err
+	}
+
+	catalog := auth.NewIRODSCatalogClient(ctx, config)
+	defer catalog.Close()
+
+	loggedIn, sessionToken, host, err := authViaPassword(ctx, config, catalog)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			auth.RecordAuthFailure(config)
+		}
+
+		log.WithError(err).Errorf("Authenticated failed for user '%s' using password", config.SFTPGoAuthdUsername)
+		return nil, err
+	}
+
+	if loggedIn {
+		log.Infof("Authenticated user '%s' using password, creating a SFTPGoUser", config.SFTPGoAuthdUsername)
+
+		err = auth.CheckAccessPolicy(config, catalog)
+		if err != nil {
+			log.WithError(err).Errorf("Authenticated failed for user '%s' using password", config.SFTPGoAuthdUsername)
+			return nil, err
+		}
+
+		// denied users keep their failures
+		auth.RecordAuthSuccess(config)
+
+		userOptions := auth.SFTPGoUserOptions{
+			SessionToken:     sessionToken,
+			Host:             host,
+			AllowedProtocols: allowedProtocols,
+		}
+
+		err = applyGroupPolicy(config, catalog, &userOptions)
+		if err != nil {
+			log.WithError(err).Errorf("Authenticated failed for user '%s' using password", config.SFTPGoAuthdUsername)
+			return nil, err
+		}
+
+		// anonymous user doesn't have home dir, the home mount template is only for authenticated users
+		mountPaths, err := makeMountPaths(config, &mountRequest{
+			authMethod: auditMethod,
+			homePath:   config.GetHomeDirPath(),
+			catalog:    catalog,
+		})
+		if err != nil {
+			log.WithError(err).Errorf("Authenticated failed for user '%s' using password", config.SFTPGoAuthdUsername)
+			return nil, err
+		}
+
+		sftpGoUser, err := auth.MakeSFTPGoUser(config, config.SFTPGoAuthdUsername, mountPaths, userOptions)
+		if err != nil {
+			log.WithError(err).Errorf("Authenticated failed for user '%s' using password", config.SFTPGoAuthdUsername)
+			return nil, err
+		}
+
+		return sftpGoUser, nil
+	}
+
+	return nil, fmt.Errorf("unable to auth the user %s: %w", config.SFTPGoAuthdUsername, auth.ErrInvalidCredentials)
+}
@@ -0,0 +1,24 @@
+package authirods
+
+import (
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	log "github.com/sirupsen/logrus"
+)
+
+// applyGroupPolicy limits the options by group policies of the user, and checks the protocol of the request again
+func applyGroupPolicy(config *commons.Config, catalog auth.CatalogClient, options *auth.SFTPGoUserOptions) error {
+	policy, err := auth.GetGroupPolicy(config, catalog)
+	if err != nil {
+		return err
+	}
+
+	if policy == nil {
+		return nil
+	}
+
+	log.Debugf("applying group policy to the user '%s' - %+v", config.SFTPGoAuthdUsername, *policy)
+	policy.Apply(options)
+
+	return auth.CheckProtocol(config, options.AllowedProtocols)
+}
@@ -0,0 +1,216 @@
+package authirods
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// 16 hex characters
+	publicKeyNameFingerprintBytes int = 8
+	legacyPublicKeyNameLength     int = 15
+)
+
+func authPublicKeyFake(config *commons.Config) (*types.SFTPGoUser, error) {
+	err := config.ValidateForPublicKeyAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Authenticated user '%s' using public key, creating a SFTPGoUser", config.SFTPGoAuthdUsername)
+
+	// return the authenticated user
+	sftpgoUsername := config.SFTPGoAuthdUsername
+
+	mountPaths, err := makeMountPaths(config, &mountRequest{
+		authMethod: commons.AuditMethodPublicKey,
+		homePath:   config.GetHomeDirPath(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sftpGoUser, err := auth.MakeSFTPGoUser(config, sftpgoUsername, mountPaths, auth.SFTPGoUserOptions{
+		AllowedProtocols: auth.GetAllowedProtocols(config, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sftpGoUser, nil
+}
+
+func authPublicKey(ctx context.Context, config *commons.Config) (sftpGoUser *types.SFTPGoUser, err error) {
+	auditRecord := newAuditRecord(config, commons.AuditMethodPublicKey)
+	defer func() {
+		writeAuditRecord(auditRecord, sftpGoUser, err)
+	}()
+
+	userKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(config.SFTPGoAuthdPublickey))
+	if err == nil {
+		auditRecord.KeyFingerprint = ssh.FingerprintSHA256(userKey)
+	}
+
+	err = config.ValidateForPublicKeyAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	// reject before connecting to iRODS
+	err = auth.CheckProtocol(config, auth.GetAllowedProtocols(config, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	loggedIn, authorizedKey, host, err := auth.AuthViaPublicKey(ctx, config)
+	if authorizedKey != nil {
+		auditRecord.KeySource = authorizedKey.Source
+		auditRecord.KeyLineNumber = authorizedKey.LineNumber
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if loggedIn {
+		log.Infof("Authenticated user '%s' using public key in %s line %d, creating a SFTPGoUser", config.SFTPGoAuthdUsername, authorizedKey.Source, authorizedKey.LineNumber)
+
+		// must have .ssh dir to reach here!
+		// create .ssh dir
+		//err := auth.CreateSshDir(config)
+		//if err != nil {
+		//	return nil, err
+		//}
+
+		// return the authenticated user
+		userHomePath := config.GetHomeDirPath()
+		customUserHomePath := auth.GetHomeCollectionPath(config, authorizedKey.Options)
+		sftpgoUsername := config.SFTPGoAuthdUsername
+
+		catalog := auth.NewIRODSCatalogClient(ctx, config)
+		defer catalog.Close()
+
+		err = auth.CheckAccessPolicy(config, catalog)
+		if err != nil {
+			log.WithError(err).Errorf("Authenticated failed for user '%s' using public key", config.SFTPGoAuthdUsername)
+			return nil, err
+		}
+
+		// checked already in auth
+		expiresAt, _ := auth.GetKeyExpiryTime(authorizedKey.Options, config.GetPublicKeyTimeLocation())
+
+		userOptions := auth.SFTPGoUserOptions{
+			Host:             host,
+			Permissions:      authorizedKey.Options.GetPermissions(),
+			AllowedProtocols: auth.GetAllowedProtocols(config, authorizedKey.Options),
+			ExpiresAt:        expiresAt,
+		}
+
+		err = applyGroupPolicy(config, catalog, &userOptions)
+		if err != nil {
+			log.WithError(err).Errorf("Authenticated failed for user '%s' using public key", config.SFTPGoAuthdUsername)
+			return nil, err
+		}
+
+		request := &mountRequest{
+			authMethod: commons.AuditMethodPublicKey,
+			homePath:   userHomePath,
+			catalog:    catalog,
+		}
+
+		if userHomePath != customUserHomePath {
+			// set a new home path
+			pubKeyName, err := makePublicKeyName(config, authorizedKey)
+			if err != nil {
+				return nil, err
+			}
+
+			// assign a new user
+			sftpgoUsername = fmt.Sprintf("%s_%s", config.SFTPGoAuthdUsername, pubKeyName)
+
+			// We don't give access to .ssh dir to not allow editting the authorized_keys file
+			request.homePath = customUserHomePath
+			request.pubKeyName = pubKeyName
+		}
+
+		mountPaths, err := makeMountPaths(config, request)
+		if err != nil {
+			log.WithError(err).Errorf("Authenticated failed for user '%s' using public key", config.SFTPGoAuthdUsername)
+			return nil, err
+		}
+
+		sftpGoUser, err := auth.MakeSFTPGoUser(config, sftpgoUsername, mountPaths, userOptions)
+		if err != nil {
+			log.WithError(err).Errorf("Authenticated failed for user '%s' using public key", config.SFTPGoAuthdUsername)
+			return nil, err
+		}
+
+		return sftpGoUser, nil
+	}
+
+	return nil, fmt.Errorf("unable to auth the user %s: %w", config.SFTPGoAuthdUsername, auth.ErrKeyNotFound)
+}
+
+// makePublicKeyName returns a name for the key, used in per-key SFTPGo username and virtual folder names.
+// It is the key's name= option if given, otherwise derived from SHA256 fingerprint of the key.
+func makePublicKeyName(config *commons.Config, authorizedKey *auth.AuthorizedKey) (string, error) {
+	if len(authorizedKey.Options.Name) > 0 {
+		return authorizedKey.Options.Name, nil
+	}
+
+	userKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(config.SFTPGoAuthdPublickey))
+	if err != nil {
+		return "", err
+	}
+
+	if userCert, ok := userKey.(*ssh.Certificate); ok {
+		// certificates are reissued often, use the certified key to keep the name
+		userKey = userCert.Key
+	} else if legacyName, ok := getLegacyPublicKeyName(config, authorizedKey); ok {
+		return legacyName, nil
+	}
+
+	fingerprint := sha256.Sum256(userKey.Marshal())
+	return hex.EncodeToString(fingerprint[:publicKeyNameFingerprintBytes]), nil
+}
+
+// getLegacyPublicKeyName returns the name used before fingerprint-based names,
+// if SFTPGo already has the user for it and no other key of the user can map to the same name.
+// The legacy name is the first 15 base64 characters of the key, that are the same for all keys of a type.
+func getLegacyPublicKeyName(config *commons.Config, authorizedKey *auth.AuthorizedKey) (string, bool) {
+	if authorizedKey.SameTypeHomeKeys != 1 {
+		return "", false
+	}
+
+	fields := strings.Fields(config.SFTPGoAuthdPublickey)
+	key := config.SFTPGoAuthdPublickey
+	if len(fields) >= 2 {
+		key = fields[1]
+	}
+
+	if len(key) < legacyPublicKeyNameLength {
+		return "", false
+	}
+
+	legacyName := strings.ReplaceAll(key[:legacyPublicKeyNameLength], " ", "_")
+	legacyUserPath := path.Join(config.SFTPGoHomeDir, fmt.Sprintf("%s_%s", config.SFTPGoAuthdUsername, legacyName))
+
+	_, err := os.Stat(legacyUserPath)
+	if err != nil {
+		return "", false
+	}
+
+	log.Debugf("using legacy public key name '%s' for existing user dir '%s'", legacyName, legacyUserPath)
+	return legacyName, true
+}
@@ -0,0 +1,79 @@
+package authirods
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+const testPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBeQ2I2+6o8s3PbFhV5BfTSCWBm6PJE5YO0JrrKUBrzh user1"
+
+func TestMakePublicKeyName(t *testing.T) {
+	const fingerprintName = "7495c1c35fd277e6"
+	const legacyName = "AAAAC3NzaC1lZDI"
+
+	tests := []struct {
+		name             string
+		keyName          string
+		sameTypeHomeKeys int
+		legacyUserDir    bool
+		want             string
+	}{
+		{"name option", "laptop", 1, true, "laptop"},
+		{"fingerprint", "", 0, false, fingerprintName},
+		{"fingerprint without legacy user dir", "", 1, false, fingerprintName},
+		{"legacy name of existing user dir", "", 1, true, legacyName},
+		{"fingerprint of many keys of the type", "", 2, true, fingerprintName},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &commons.Config{
+				SFTPGoHomeDir:        t.TempDir(),
+				SFTPGoAuthdUsername:  "user1",
+				SFTPGoAuthdPublickey: testPublicKey,
+			}
+
+			if test.legacyUserDir {
+				err := os.Mkdir(filepath.Join(config.SFTPGoHomeDir, "user1_"+legacyName), 0700)
+				if err != nil {
+					t.Fatalf("failed to make a legacy user dir: %v", err)
+				}
+			}
+
+			authorizedKey := &auth.AuthorizedKey{
+				Options: &auth.KeyOptions{
+					Name: test.keyName,
+				},
+				SameTypeHomeKeys: test.sameTypeHomeKeys,
+			}
+
+			got, err := makePublicKeyName(config, authorizedKey)
+			if err != nil {
+				t.Fatalf("failed to make a public key name: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("public key name = %q, want %q", got, test.want)
+			}
+			if !commons.IsValidName(got) {
+				t.Errorf("public key name %q is not a valid name", got)
+			}
+		})
+	}
+}
+
+func TestGetLegacyPublicKeyNameShortKey(t *testing.T) {
+	config := &commons.Config{
+		SFTPGoHomeDir:        t.TempDir(),
+		SFTPGoAuthdUsername:  "user1",
+		SFTPGoAuthdPublickey: "ssh-ed25519 AAAA",
+	}
+
+	_, ok := getLegacyPublicKeyName(config, &auth.AuthorizedKey{SameTypeHomeKeys: 1})
+	if ok {
+		t.Errorf("legacy name is made of a key shorter than the name")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cyverse/sftpgo-auth-irods/authirods"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// runKeyboardInteractive talks SFTPGo's keyboard interactive hook protocol over stdin/stdout.
+// SFTPGo runs the hook without args, so keyboard_interactive_auth_hook must be a wrapper script
+// that runs this sub command.
+func runKeyboardInteractive(args []string) {
+	var configPath string
+
+	kiFlags := flag.NewFlagSet("keyboard-interactive", flag.ExitOnError)
+	kiFlags.StringVar(&configPath, "config", os.Getenv(configPathEnv), "Config file path (YAML or JSON), env vars override values in the file")
+	kiFlags.Parse(args)
+
+	// read config file and environmental vars
+	config, err := commons.ReadConfig(configPath)
+	if err != nil {
+		exitKeyboardInteractiveError(err)
+		return
+	}
+
+	err = prepareLogDir(config)
+	if err != nil {
+		exitKeyboardInteractiveError(err)
+		return
+	}
+
+	commons.SetLog(config.SFTPGoLogDir)
+	commons.SetAuditLog(config.SFTPGoLogDir)
+
+	authenticator := authirods.NewAuthenticator(config)
+	request := authirods.KeyboardInteractiveRequest{
+		Username: config.SFTPGoAuthdUsername,
+		IP:       config.SFTPGoAuthdIP,
+	}
+
+	err = runKeyboardInteractiveSteps(context.Background(), authenticator, request, os.Stdin, os.Stdout)
+	if err != nil {
+		exitKeyboardInteractiveError(err)
+		return
+	}
+
+	os.Exit(0)
+}
+
+// keyboardInteractiveAuthenticator runs steps of keyboard interactive auth, *authirods.Authenticator satisfies this interface
+type keyboardInteractiveAuthenticator interface {
+	AuthenticateKeyboardInteractive(ctx context.Context, request authirods.KeyboardInteractiveRequest) (*types.SFTPGoKeyboardInteractiveResponse, error)
+}
+
+// runKeyboardInteractiveSteps writes questions, reads answers and writes the auth result
+func runKeyboardInteractiveSteps(ctx context.Context, authenticator keyboardInteractiveAuthenticator, request authirods.KeyboardInteractiveRequest, reader io.Reader, writer io.Writer) error {
+	// ask questions
+	response, err := authenticator.AuthenticateKeyboardInteractive(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	printKeyboardInteractiveResponse(writer, response)
+
+	// SFTPGo writes answers one per line in the same order of questions
+	bufReader := bufio.NewReader(reader)
+	for range response.Questions {
+		line, err := bufReader.ReadString('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return err
+		}
+
+		request.Answers = append(request.Answers, strings.TrimRight(line, "\r\n"))
+	}
+
+	// check answers
+	response, err = authenticator.AuthenticateKeyboardInteractive(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	printKeyboardInteractiveResponse(writer, response)
+	return nil
+}
+
+func printKeyboardInteractiveResponse(writer io.Writer, response *types.SFTPGoKeyboardInteractiveResponse) {
+	resp, _ := json.Marshal(response)
+	fmt.Fprintf(writer, "%v\n", string(resp))
+}
+
+func exitKeyboardInteractiveError(err error) {
+	log.Error(err)
+
+	printKeyboardInteractiveResponse(os.Stdout, types.NewSFTPGoKeyboardInteractiveResponseForError())
+	os.Exit(1)
+}
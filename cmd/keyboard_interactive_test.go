@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyverse/sftpgo-auth-irods/authirods"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+)
+
+// fakeKeyboardInteractiveAuthenticator asks two questions and accepts the expected answers
+type fakeKeyboardInteractiveAuthenticator struct {
+	wantAnswers []string
+	requests    []authirods.KeyboardInteractiveRequest
+}
+
+func (authenticator *fakeKeyboardInteractiveAuthenticator) AuthenticateKeyboardInteractive(ctx context.Context, request authirods.KeyboardInteractiveRequest) (*types.SFTPGoKeyboardInteractiveResponse, error) {
+	authenticator.requests = append(authenticator.requests, request)
+
+	if len(request.Answers) == 0 {
+		return &types.SFTPGoKeyboardInteractiveResponse{
+			Questions: []string{"Password: ", "One-time code: "},
+			Echos:     []bool{false, false},
+		}, nil
+	}
+
+	if !reflect.DeepEqual(request.Answers, authenticator.wantAnswers) {
+		return types.NewSFTPGoKeyboardInteractiveResponseForError(), nil
+	}
+	return &types.SFTPGoKeyboardInteractiveResponse{
+		AuthResult: 1,
+	}, nil
+}
+
+func TestRunKeyboardInteractiveSteps(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantAnswers []string
+		wantResult  int
+	}{
+		{"answers", "password\n123456\n", []string{"password", "123456"}, 1},
+		{"crlf and no trailing newline", "password\r\n123456", []string{"password", "123456"}, 1},
+		{"empty answer", "\n123456\n", []string{"", "123456"}, -1},
+		{"wrong answers", "password\n000000\n", []string{"password", "000000"}, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator := &fakeKeyboardInteractiveAuthenticator{
+				wantAnswers: []string{"password", "123456"},
+			}
+			request := authirods.KeyboardInteractiveRequest{
+				Username: "user1",
+				IP:       "127.0.0.1",
+			}
+
+			output := bytes.Buffer{}
+			err := runKeyboardInteractiveSteps(context.Background(), authenticator, request, strings.NewReader(test.input), &output)
+			if err != nil {
+				t.Fatalf("failed to run keyboard interactive steps: %v", err)
+			}
+
+			if len(authenticator.requests) != 2 {
+				t.Fatalf("authenticator is called %d times, want 2", len(authenticator.requests))
+			}
+			if len(authenticator.requests[0].Answers) != 0 {
+				t.Errorf("first step has answers %q", authenticator.requests[0].Answers)
+			}
+			if got := authenticator.requests[1].Answers; !reflect.DeepEqual(got, test.wantAnswers) {
+				t.Errorf("answers = %q, want %q", got, test.wantAnswers)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("output = %q, want a line per step", output.String())
+			}
+
+			questions := types.SFTPGoKeyboardInteractiveResponse{}
+			err = json.Unmarshal([]byte(lines[0]), &questions)
+			if err != nil || len(questions.Questions) != 2 || questions.AuthResult != 0 {
+				t.Errorf("first step output = %q", lines[0])
+			}
+
+			result := types.SFTPGoKeyboardInteractiveResponse{}
+			err = json.Unmarshal([]byte(lines[1]), &result)
+			if err != nil || result.AuthResult != test.wantResult {
+				t.Errorf("second step output = %q, want auth result %d", lines[1], test.wantResult)
+			}
+		})
+	}
+}
+
+func TestRunKeyboardInteractiveStepsMissingAnswer(t *testing.T) {
+	authenticator := &fakeKeyboardInteractiveAuthenticator{}
+	request := authirods.KeyboardInteractiveRequest{
+		Username: "user1",
+		IP:       "127.0.0.1",
+	}
+
+	output := bytes.Buffer{}
+	err := runKeyboardInteractiveSteps(context.Background(), authenticator, request, strings.NewReader("password\n"), &output)
+	if err == nil {
+		t.Fatal("missing answer is accepted")
+	}
+	if len(authenticator.requests) != 1 {
+		t.Errorf("answers are checked after a missing answer")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+)
+
+// runLockout lists or clears lockouts, for admins
+func runLockout(args []string) {
+	if len(args) == 0 {
+		exitLockoutError(errors.New("lockout sub command is not given, use 'list' or 'clear'"))
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		runLockoutList(args[1:])
+	case "clear":
+		runLockoutClear(args[1:])
+	default:
+		exitLockoutError(fmt.Errorf("unknown lockout sub command %q, use 'list' or 'clear'", args[0]))
+	}
+}
+
+func runLockoutList(args []string) {
+	var configPath string
+
+	listFlags := flag.NewFlagSet("lockout list", flag.ExitOnError)
+	listFlags.StringVar(&configPath, "config", os.Getenv(configPathEnv), "Config file path (YAML or JSON), env vars override values in the file")
+	listFlags.Parse(args)
+
+	config := readLockoutConfig(configPath)
+
+	lockouts, err := auth.ListLockouts(config)
+	if err != nil {
+		exitLockoutError(err)
+		return
+	}
+
+	now := time.Now()
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "KIND\tNAME\tFAILURES\tLAST FAILURE\tLOCKED UNTIL")
+	for _, lockout := range lockouts {
+		lockedUntil := "-"
+		if lockout.IsLocked(now) {
+			lockedUntil = lockout.LockedUntil.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\n", lockout.Kind, lockout.Name, lockout.Failures, lockout.LastFailure.Format(time.RFC3339), lockedUntil)
+	}
+	writer.Flush()
+}
+
+func runLockoutClear(args []string) {
+	var configPath string
+	var username string
+	var clientIP string
+	var all bool
+
+	clearFlags := flag.NewFlagSet("lockout clear", flag.ExitOnError)
+	clearFlags.StringVar(&configPath, "config", os.Getenv(configPathEnv), "Config file path (YAML or JSON), env vars override values in the file")
+	clearFlags.StringVar(&username, "user", "", "Clear the user")
+	clearFlags.StringVar(&clientIP, "ip", "", "Clear the client IP")
+	clearFlags.BoolVar(&all, "all", false, "Clear all users and client IPs")
+	clearFlags.Parse(args)
+
+	targets := 0
+	for _, given := range []bool{len(username) > 0, len(clientIP) > 0, all} {
+		if given {
+			targets++
+		}
+	}
+	if targets != 1 {
+		exitLockoutError(errors.New("one of --user, --ip or --all must be given"))
+		return
+	}
+
+	config := readLockoutConfig(configPath)
+
+	kind := ""
+	name := ""
+	if len(username) > 0 {
+		kind = auth.LockoutKindUser
+		name = username
+	} else if len(clientIP) > 0 {
+		kind = auth.LockoutKindClientIP
+		name = clientIP
+	}
+
+	cleared, err := auth.ClearLockouts(config, kind, name)
+	if err != nil {
+		exitLockoutError(err)
+		return
+	}
+
+	fmt.Printf("Cleared %d lockout records\n", cleared)
+}
+
+func readLockoutConfig(configPath string) *commons.Config {
+	config, err := commons.ReadConfig(configPath)
+	if err != nil {
+		exitLockoutError(err)
+		return nil
+	}
+
+	if !config.IsLockoutEnabled() {
+		exitLockoutError(errors.New("lockout dir is not given"))
+		return nil
+	}
+
+	return config
+}
+
+func exitLockoutError(err error) {
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
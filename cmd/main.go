@@ -1,30 +1,53 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
-	"strings"
 
-	"github.com/cyverse/sftpgo-auth-irods/auth"
+	"github.com/cyverse/sftpgo-auth-irods/authirods"
 	"github.com/cyverse/sftpgo-auth-irods/commons"
 	"github.com/cyverse/sftpgo-auth-irods/types"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// configPathEnv gives a config file path when --config flag is not given,
+	// as SFTPGo runs the auth hook without args
+	configPathEnv string = "SFTPGO_AUTH_IRODS_CONFIG"
+)
+
 func main() {
 	// set logger
 	defaultLogPath := commons.GetDefaultLogPath()
 	commons.SetLog(defaultLogPath)
 
+	// sub commands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "lockout":
+			runLockout(os.Args[2:])
+			return
+		case "keyboard-interactive":
+			runKeyboardInteractive(os.Args[2:])
+			return
+		}
+	}
+
 	// Parse parameters
 	var version bool
 	var fakeoutput bool
+	var configPath string
 
 	flag.BoolVar(&version, "version", false, "Print client version information")
 	flag.BoolVar(&version, "v", false, "Print client version information (shorthand form)")
 	flag.BoolVar(&fakeoutput, "fake", false, "Generate fake output json")
+	flag.StringVar(&configPath, "config", os.Getenv(configPathEnv), "Config file path (YAML or JSON), env vars override values in the file")
 
 	flag.Parse()
 
@@ -39,291 +62,64 @@ func main() {
 		return
 	}
 
-	// read environmental vars
-	config, err := commons.ReadFromEnv()
+	// read config file and environmental vars
+	config, err := commons.ReadConfig(configPath)
 	if err != nil {
 		exitError(err)
 		return
 	}
 
-	_, err = os.Stat(config.SFTPGoLogDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			err2 := os.MkdirAll(config.SFTPGoLogDir, 0644)
-			if err2 != nil {
-				// failed to create a log dir
-				exitError(err)
-				return
-			}
-		} else {
-			// failed to access a log dir
-			exitError(err)
-			return
-		}
-	}
-
-	commons.SetLog(config.SFTPGoLogDir)
-
-	err = config.Validate()
+	err = prepareLogDir(config)
 	if err != nil {
 		exitError(err)
 		return
 	}
 
-	if config.IsPublicKeyAuth() {
-		var sftpGoUser *types.SFTPGoUser
-		var err error
-
-		if fakeoutput {
-			sftpGoUser, err = authPublicKeyFake(config)
-		} else {
-			sftpGoUser, err = authPublicKey(config)
-		}
-
-		if err != nil {
-			exitError(err)
-			return
-		}
-
-		printSuccessResponse(sftpGoUser)
-		return
-	} else {
-		var sftpGoUser *types.SFTPGoUser
-		var err error
-
-		if fakeoutput {
-			sftpGoUser, err = authPasswordFake(config)
-		} else {
-			sftpGoUser, err = authPassword(config)
-		}
-
-		if err != nil {
-			exitError(err)
-			return
-		}
-
-		printSuccessResponse(sftpGoUser)
-		return
-	}
-}
-
-func authPublicKeyFake(config *commons.Config) (*types.SFTPGoUser, error) {
-	err := config.ValidateForPublicKeyAuth()
-	if err != nil {
-		return nil, err
-	}
-
-	log.Infof("Authenticated user '%s' using public key, creating a SFTPGoUser", config.SFTPGoAuthdUsername)
-
-	// return the authenticated user
-	mountPaths := []types.MountPath{}
-
-	sftpgoUsername := config.SFTPGoAuthdUsername
-
-	mountPaths = append(mountPaths, makeMountPathForHome(config))
-
-	//mountPaths = append(mountPaths, makeMountPathForSSHDir(config))
-
-	if config.HasSharedDir() {
-		mountPaths = append(mountPaths, makeMountPathForSharedDir(config))
-	}
-
-	sftpGoUser, err := auth.MakeSFTPGoUser(config, sftpgoUsername, mountPaths)
-	if err != nil {
-		return nil, err
-	}
-
-	return sftpGoUser, nil
-}
-
-func authPasswordFake(config *commons.Config) (*types.SFTPGoUser, error) {
-	if config.IsAnonymousUser() {
-		// overwrite existing account info to ensure correct spell/case and empty password
-		config.SFTPGoAuthdUsername = "anonymous"
-		config.SFTPGoAuthdPassword = "" // empty password
-	}
-
-	log.Infof("Authenticated user '%s' using password, creating a SFTPGoUser", config.SFTPGoAuthdUsername)
+	commons.SetLog(config.SFTPGoLogDir)
+	commons.SetAuditLog(config.SFTPGoLogDir)
 
-	mountPaths := []types.MountPath{}
-	if !config.IsAnonymousUser() {
-		// anonymous user doesn't have home dir
-		// so do this only if user is not anonymous
-		mountPaths = append(mountPaths, makeMountPathForHome(config))
+	authenticator := authirods.NewAuthenticator(config)
+	request := authirods.Request{
+		Username:  config.SFTPGoAuthdUsername,
+		Password:  config.SFTPGoAuthdPassword,
+		PublicKey: config.SFTPGoAuthdPublickey,
+		IP:        config.SFTPGoAuthdIP,
+		Protocol:  config.SFTPGoAuthdProtocol,
 
-		//mountPaths = append(mountPaths, makeMountPathForSSHDir(config))
+		KeyboardInteractive: config.IsKeyboardInteractiveAuth(),
 	}
 
-	if config.HasSharedDir() {
-		mountPaths = append(mountPaths, makeMountPathForSharedDir(config))
+	var sftpGoUser *types.SFTPGoUser
+	if fakeoutput {
+		sftpGoUser, err = authenticator.AuthenticateFake(context.Background(), request)
+	} else {
+		sftpGoUser, err = authenticator.Authenticate(context.Background(), request)
 	}
 
-	sftpGoUser, err := auth.MakeSFTPGoUser(config, config.SFTPGoAuthdUsername, mountPaths)
 	if err != nil {
-		return nil, err
+		exitError(err)
+		return
 	}
 
-	return sftpGoUser, nil
+	printSuccessResponse(sftpGoUser)
 }
 
-func authPublicKey(config *commons.Config) (*types.SFTPGoUser, error) {
-	err := config.ValidateForPublicKeyAuth()
-	if err != nil {
-		return nil, err
-	}
-
-	loggedIn, options, err := auth.AuthViaPublicKey(config)
+func prepareLogDir(config *commons.Config) error {
+	_, err := os.Stat(config.SFTPGoLogDir)
 	if err != nil {
-		return nil, err
-	}
-
-	if loggedIn {
-		log.Infof("Authenticated user '%s' using public key, creating a SFTPGoUser", config.SFTPGoAuthdUsername)
-
-		// must have .ssh dir to reach here!
-		// create .ssh dir
-		//err := auth.CreateSshDir(config)
-		//if err != nil {
-		//	return nil, err
-		//}
-
-		// return the authenticated user
-		mountPaths := []types.MountPath{}
-
-		userHomePath := config.GetHomeDirPath()
-		customUserHomePath := auth.GetHomeCollectionPath(config, options)
-		sftpgoUsername := config.SFTPGoAuthdUsername
-
-		if userHomePath != customUserHomePath {
-			// set a new home path
-			pubKeyName := makeSafePublickKeyName(config.SFTPGoAuthdPublickey)
-			// assign a new user
-			sftpgoUsername = fmt.Sprintf("%s_%s", config.SFTPGoAuthdUsername, pubKeyName)
-
-			mountPaths = append(mountPaths, makeMountPathForCustomHome(config, customUserHomePath, pubKeyName))
-
-			// We don't give access to .ssh dir to not allow editting the authorized_keys file
-			//mountPaths = append(mountPaths, makeMountPathForSSHDir(config))
-
-			if config.HasSharedDir() {
-				mountPaths = append(mountPaths, makeMountPathForCustomSharedDir(config, pubKeyName))
+		if os.IsNotExist(err) {
+			err2 := os.MkdirAll(config.SFTPGoLogDir, 0644)
+			if err2 != nil {
+				// failed to create a log dir
+				return err
 			}
 		} else {
-			mountPaths = append(mountPaths, makeMountPathForHome(config))
-
-			//mountPaths = append(mountPaths, makeMountPathForSSHDir(config))
-
-			if config.HasSharedDir() {
-				mountPaths = append(mountPaths, makeMountPathForSharedDir(config))
-			}
-		}
-
-		sftpGoUser, err := auth.MakeSFTPGoUser(config, sftpgoUsername, mountPaths)
-		if err != nil {
-			return nil, err
-		}
-
-		return sftpGoUser, nil
-	}
-
-	return nil, fmt.Errorf("unable to auth the user %s", config.SFTPGoAuthdUsername)
-}
-
-func authPassword(config *commons.Config) (*types.SFTPGoUser, error) {
-	if config.IsAnonymousUser() {
-		// overwrite existing account info to ensure correct spell/case and empty password
-		config.SFTPGoAuthdUsername = "anonymous"
-		config.SFTPGoAuthdPassword = "" // empty password
-	}
-
-	loggedIn, err := auth.AuthViaPassword(config)
-	if err != nil {
-		log.WithError(err).Errorf("Authenticated failed for user '%s' using password", config.SFTPGoAuthdUsername)
-		return nil, err
-	}
-
-	if loggedIn {
-		log.Infof("Authenticated user '%s' using password, creating a SFTPGoUser", config.SFTPGoAuthdUsername)
-
-		// create .ssh dir
-		if !config.IsAnonymousUser() {
-			err := auth.CreateSshDir(config)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		mountPaths := []types.MountPath{}
-		if !config.IsAnonymousUser() {
-			// anonymous user doesn't have home dir
-			// so do this only if user is not anonymous
-			mountPaths = append(mountPaths, makeMountPathForHome(config))
-
-			//mountPaths = append(mountPaths, makeMountPathForSSHDir(config))
-		}
-
-		if config.HasSharedDir() {
-			mountPaths = append(mountPaths, makeMountPathForSharedDir(config))
-		}
-
-		sftpGoUser, err := auth.MakeSFTPGoUser(config, config.SFTPGoAuthdUsername, mountPaths)
-		if err != nil {
-			return nil, err
+			// failed to access a log dir
+			return err
 		}
-
-		return sftpGoUser, nil
 	}
 
-	return nil, fmt.Errorf("unable to auth the user %s", config.SFTPGoAuthdUsername)
-}
-
-func makeMountPathForHome(config *commons.Config) types.MountPath {
-	userHomePath := config.GetHomeDirPath()
-	return types.MountPath{
-		Name:           fmt.Sprintf("%s_home", config.SFTPGoAuthdUsername),
-		DirName:        config.SFTPGoAuthdUsername,
-		Description:    "iRODS home",
-		CollectionPath: userHomePath,
-	}
-}
-
-func makeMountPathForCustomHome(config *commons.Config, customUserHomePath string, pubKeyName string) types.MountPath {
-	return types.MountPath{
-		Name:           fmt.Sprintf("%s_home_%s", config.SFTPGoAuthdUsername, pubKeyName),
-		DirName:        config.SFTPGoAuthdUsername,
-		Description:    fmt.Sprintf("iRODS home - %s", customUserHomePath),
-		CollectionPath: customUserHomePath,
-	}
-}
-
-func makeMountPathForSSHDir(config *commons.Config) types.MountPath {
-	userHomePath := config.GetHomeDirPath()
-	return types.MountPath{
-		Name:           fmt.Sprintf("%s_ssh", config.SFTPGoAuthdUsername),
-		DirName:        ".ssh",
-		Description:    "iRODS .ssh dir",
-		CollectionPath: fmt.Sprintf("%s/.ssh", userHomePath),
-	}
-}
-
-func makeMountPathForSharedDir(config *commons.Config) types.MountPath {
-	sharedDirName := config.GetSharedDirName()
-	return types.MountPath{
-		Name:           fmt.Sprintf("%s_%s", config.SFTPGoAuthdUsername, sharedDirName),
-		DirName:        sharedDirName,
-		Description:    fmt.Sprintf("iRODS %s", sharedDirName),
-		CollectionPath: config.IRODSShared,
-	}
-}
-
-func makeMountPathForCustomSharedDir(config *commons.Config, pubKeyName string) types.MountPath {
-	sharedDirName := config.GetSharedDirName()
-	return types.MountPath{
-		Name:           fmt.Sprintf("%s_%s_%s", config.SFTPGoAuthdUsername, sharedDirName, pubKeyName),
-		DirName:        sharedDirName,
-		Description:    fmt.Sprintf("iRODS %s", sharedDirName),
-		CollectionPath: config.IRODSShared,
-	}
+	return nil
 }
 
 func exitError(err error) {
@@ -343,13 +139,3 @@ func printSuccessResponse(sftpGoUser *types.SFTPGoUser) {
 	fmt.Printf("%v\n", string(resp))
 	os.Exit(0)
 }
-
-func makeSafePublickKeyName(pubkey string) string {
-	fields := strings.Fields(pubkey)
-	key := pubkey
-	if len(fields) >= 2 {
-		key = fields[1]
-	}
-
-	return strings.ReplaceAll(key[:15], " ", "_")
-}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cyverse/sftpgo-auth-irods/authirods"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultServeListen    string        = "tcp://127.0.0.1:8090"
+	serveReadTimeout      time.Duration = 30 * time.Second
+	serveShutdownTimeout  time.Duration = 30 * time.Second
+	serveMaxRequestLength int64         = 1024 * 1024 // 1MB
+)
+
+// runServe runs an HTTP server that SFTPGo can call as its external auth hook,
+// and as its keyboard interactive hook at /keyboard-interactive
+func runServe(args []string) {
+	var listen string
+	var fakeoutput bool
+	var configPath string
+
+	serveFlags := flag.NewFlagSet("serve", flag.ExitOnError)
+	serveFlags.StringVar(&listen, "listen", defaultServeListen, "Address to listen on, 'tcp://<host>:<port>' or 'unix://<socket path>'")
+	serveFlags.BoolVar(&fakeoutput, "fake", false, "Generate fake output json")
+	serveFlags.StringVar(&configPath, "config", os.Getenv(configPathEnv), "Config file path (YAML or JSON), env vars override values in the file")
+	serveFlags.Parse(args)
+
+	// read config file and environmental vars
+	config, err := commons.ReadConfig(configPath)
+	if err != nil {
+		exitServeError(err)
+		return
+	}
+
+	err = prepareLogDir(config)
+	if err != nil {
+		exitServeError(err)
+		return
+	}
+
+	commons.SetLog(config.SFTPGoLogDir)
+	commons.SetAuditLog(config.SFTPGoLogDir)
+
+	err = config.ValidateForServe()
+	if err != nil {
+		exitServeError(err)
+		return
+	}
+
+	listener, err := makeServeListener(listen)
+	if err != nil {
+		exitServeError(err)
+		return
+	}
+
+	authenticator := authirods.NewAuthenticator(config)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handleAuthRequest(w, r, authenticator, fakeoutput)
+	})
+	mux.HandleFunc("/keyboard-interactive", func(w http.ResponseWriter, r *http.Request) {
+		handleKeyboardInteractiveRequest(w, r, authenticator)
+	})
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: serveReadTimeout,
+		ReadTimeout:       serveReadTimeout,
+	}
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-signalChan
+		log.Infof("Shutting down the auth server")
+
+		ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+
+		server.Shutdown(ctx)
+	}()
+
+	log.Infof("Serving auth requests on %s", listen)
+	err = server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		exitServeError(err)
+		return
+	}
+}
+
+func makeServeListener(listen string) (net.Listener, error) {
+	if strings.HasPrefix(listen, "unix://") {
+		socketPath := strings.TrimPrefix(listen, "unix://")
+		if len(socketPath) == 0 {
+			return nil, fmt.Errorf("unix socket path is not given")
+		}
+
+		// remove a stale socket left by a previous run
+		err := os.Remove(socketPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(true)
+		}
+
+		return listener, nil
+	}
+
+	address := strings.TrimPrefix(listen, "tcp://")
+	return net.Listen("tcp", address)
+}
+
+func handleAuthRequest(w http.ResponseWriter, r *http.Request, authenticator *authirods.Authenticator, fakeoutput bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAuthResponse(w, http.StatusMethodNotAllowed, types.NewSFTPGoUserForError())
+		return
+	}
+
+	authRequest := types.SFTPGoExternalAuthRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, serveMaxRequestLength))
+	err := decoder.Decode(&authRequest)
+	if err != nil {
+		log.WithError(err).Error("failed to decode an auth request")
+		writeAuthResponse(w, http.StatusBadRequest, types.NewSFTPGoUserForError())
+		return
+	}
+
+	request := authirods.Request{
+		Username:  authRequest.Username,
+		Password:  authRequest.Password,
+		PublicKey: authRequest.PublicKey,
+		IP:        authRequest.IP,
+		Protocol:  authRequest.Protocol,
+
+		KeyboardInteractive: len(authRequest.KeyboardInteractive) > 0,
+	}
+
+	var sftpGoUser *types.SFTPGoUser
+	if fakeoutput {
+		sftpGoUser, err = authenticator.AuthenticateFake(r.Context(), request)
+	} else {
+		sftpGoUser, err = authenticator.Authenticate(r.Context(), request)
+	}
+
+	if err != nil {
+		log.Error(err)
+		writeAuthResponse(w, http.StatusUnauthorized, types.NewSFTPGoUserForError())
+		return
+	}
+
+	redactedJSONString := sftpGoUser.GetRedactedJSONString()
+	log.Infof("Authenticated user '%s': %s", sftpGoUser.Username, redactedJSONString)
+
+	writeAuthResponse(w, http.StatusOK, sftpGoUser)
+}
+
+// handleKeyboardInteractiveRequest serves SFTPGo's HTTP keyboard interactive hook
+func handleKeyboardInteractiveRequest(w http.ResponseWriter, r *http.Request, authenticator *authirods.Authenticator) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeKeyboardInteractiveResponse(w, http.StatusMethodNotAllowed, types.NewSFTPGoKeyboardInteractiveResponseForError())
+		return
+	}
+
+	kiRequest := types.SFTPGoKeyboardInteractiveRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, serveMaxRequestLength))
+	err := decoder.Decode(&kiRequest)
+	if err != nil {
+		log.WithError(err).Error("failed to decode a keyboard interactive request")
+		writeKeyboardInteractiveResponse(w, http.StatusBadRequest, types.NewSFTPGoKeyboardInteractiveResponseForError())
+		return
+	}
+
+	request := authirods.KeyboardInteractiveRequest{
+		Username: kiRequest.Username,
+		IP:       kiRequest.IP,
+	}
+
+	// the first step only asks questions, empty answers in later steps must not ask them again
+	if kiRequest.Step > 1 {
+		if len(kiRequest.Answers) == 0 {
+			log.Errorf("no answers are given in keyboard interactive step %d of the user '%s'", kiRequest.Step, kiRequest.Username)
+			writeKeyboardInteractiveResponse(w, http.StatusOK, types.NewSFTPGoKeyboardInteractiveResponseForError())
+			return
+		}
+		request.Answers = kiRequest.Answers
+	}
+
+	response, err := authenticator.AuthenticateKeyboardInteractive(r.Context(), request)
+	if err != nil {
+		log.Error(err)
+		writeKeyboardInteractiveResponse(w, http.StatusOK, types.NewSFTPGoKeyboardInteractiveResponseForError())
+		return
+	}
+
+	writeKeyboardInteractiveResponse(w, http.StatusOK, response)
+}
+
+func writeKeyboardInteractiveResponse(w http.ResponseWriter, status int, response *types.SFTPGoKeyboardInteractiveResponse) {
+	resp, _ := json.Marshal(response)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+func writeAuthResponse(w http.ResponseWriter, status int, sftpGoUser *types.SFTPGoUser) {
+	resp, _ := json.Marshal(sftpGoUser)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+func exitServeError(err error) {
+	log.Error(err)
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyverse/sftpgo-auth-irods/authirods"
+	"github.com/cyverse/sftpgo-auth-irods/commons"
+	"github.com/cyverse/sftpgo-auth-irods/types"
+)
+
+const testServeConfigYAML = `irods_host: irods.example.com
+irods_zone: zone
+irods_auth_scheme: pam
+irods_require_cs_negotiation: true
+irods_cs_negotiation_policy: CS_NEG_REQUIRE
+irods_ssl_ca_cert_path: /etc/ssl/certs/ca.crt
+irods_ssl_algorithm: AES-256-CBC
+irods_ssl_key_size: 32
+irods_ssl_salt_size: 8
+irods_ssl_hash_rounds: 16
+irods_proxy_user: proxy
+irods_proxy_password: proxy_password
+`
+
+func newTestAuthenticator(t *testing.T) *authirods.Authenticator {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(testServeConfigYAML), 0600)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	config, err := commons.ReadConfig(configPath)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+
+	return authirods.NewAuthenticator(config)
+}
+
+func TestHandleAuthRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		body         string
+		wantStatus   int
+		wantUsername string
+	}{
+		{"success", http.MethodPost, `{"username": "user1", "password": "password", "ip": "127.0.0.1", "protocol": "SSH"}`, http.StatusOK, "user1"},
+		{"failure", http.MethodPost, `{"username": "user1", "ip": "127.0.0.1", "protocol": "SSH"}`, http.StatusUnauthorized, ""},
+		{"bad method", http.MethodGet, "", http.StatusMethodNotAllowed, ""},
+		{"malformed json", http.MethodPost, `{"username": `, http.StatusBadRequest, ""},
+	}
+
+	authenticator := newTestAuthenticator(t)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, "/", strings.NewReader(test.body))
+			recorder := httptest.NewRecorder()
+
+			// fake output builds the user without iRODS, credentials are still validated
+			handleAuthRequest(recorder, request, authenticator, true)
+
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("content type = %q", contentType)
+			}
+
+			sftpGoUser := types.SFTPGoUser{}
+			err := json.Unmarshal(recorder.Body.Bytes(), &sftpGoUser)
+			if err != nil {
+				t.Fatalf("failed to decode the response %q: %v", recorder.Body.String(), err)
+			}
+			if sftpGoUser.Username != test.wantUsername {
+				t.Errorf("username = %q, want %q", sftpGoUser.Username, test.wantUsername)
+			}
+			if test.wantStatus == http.StatusOK && sftpGoUser.Status != 1 {
+				t.Errorf("user status = %d, want an enabled user", sftpGoUser.Status)
+			}
+			if test.wantStatus == http.StatusMethodNotAllowed && recorder.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("allow header = %q", recorder.Header().Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestHandleKeyboardInteractiveRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		wantStatus     int
+		wantAuthResult int
+		wantQuestions  int
+	}{
+		{"questions", http.MethodPost, `{"request_id": "1", "step": 1, "username": "user1", "ip": "127.0.0.1"}`, http.StatusOK, 0, 2},
+		{"no answers", http.MethodPost, `{"request_id": "1", "step": 2, "username": "user1", "ip": "127.0.0.1"}`, http.StatusOK, -1, 0},
+		{"wrong number of answers", http.MethodPost, `{"request_id": "1", "step": 2, "username": "user1", "ip": "127.0.0.1", "answers": ["password"]}`, http.StatusOK, -1, 0},
+		{"anonymous", http.MethodPost, `{"request_id": "1", "step": 1, "username": "anonymous", "ip": "127.0.0.1"}`, http.StatusOK, -1, 0},
+		{"bad method", http.MethodGet, "", http.StatusMethodNotAllowed, -1, 0},
+		{"malformed json", http.MethodPost, `{"step": "one"}`, http.StatusBadRequest, -1, 0},
+	}
+
+	authenticator := newTestAuthenticator(t)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, "/keyboard-interactive", strings.NewReader(test.body))
+			recorder := httptest.NewRecorder()
+
+			handleKeyboardInteractiveRequest(recorder, request, authenticator)
+
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+
+			response := types.SFTPGoKeyboardInteractiveResponse{}
+			err := json.Unmarshal(recorder.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatalf("failed to decode the response %q: %v", recorder.Body.String(), err)
+			}
+			if response.AuthResult != test.wantAuthResult {
+				t.Errorf("auth result = %d, want %d", response.AuthResult, test.wantAuthResult)
+			}
+			if len(response.Questions) != test.wantQuestions || len(response.Echos) != test.wantQuestions {
+				t.Errorf("questions = %q, echos = %v, want %d questions", response.Questions, response.Echos, test.wantQuestions)
+			}
+		})
+	}
+}
+
+func TestMakeServeListener(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "auth.sock")
+
+	// a stale socket file is replaced
+	err := os.WriteFile(socketPath, nil, 0600)
+	if err != nil {
+		t.Fatalf("failed to write a stale socket file: %v", err)
+	}
+
+	listener, err := makeServeListener("unix://" + socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen on a unix socket: %v", err)
+	}
+	if listener.Addr().Network() != "unix" {
+		t.Errorf("network = %q, want unix", listener.Addr().Network())
+	}
+	listener.Close()
+
+	_, err = os.Stat(socketPath)
+	if !os.IsNotExist(err) {
+		t.Errorf("socket file is left after close: %v", err)
+	}
+
+	listener, err = makeServeListener("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen on tcp: %v", err)
+	}
+	if listener.Addr().Network() != "tcp" {
+		t.Errorf("network = %q, want tcp", listener.Addr().Network())
+	}
+	listener.Close()
+
+	_, err = makeServeListener("unix://")
+	if err == nil {
+		t.Errorf("empty unix socket path is accepted")
+	}
+}
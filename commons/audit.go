@@ -0,0 +1,103 @@
+package commons
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	auditLogFilename    = "sftpgo_auth_irods_audit.log"
+	auditSchemaVersion  = 1
+	auditLogPermissions = 0600
+)
+
+// audit results
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// audit auth methods
+const (
+	AuditMethodPassword            = "password"
+	AuditMethodPublicKey           = "publickey"
+	AuditMethodKeyboardInteractive = "keyboard-interactive"
+)
+
+// audit rejection reasons
+const (
+	AuditReasonInvalidCredentials   = "invalid_credentials"
+	AuditReasonKeyNotFound          = "key_not_found"
+	AuditReasonKeyExpired           = "key_expired"
+	AuditReasonKeyNotYetValid       = "key_not_yet_valid"
+	AuditReasonKeyOutsideTimeWindow = "key_outside_time_window"
+	AuditReasonClientRejected       = "client_rejected"
+	AuditReasonLockedOut            = "locked_out"
+	AuditReasonProtocolDenied       = "protocol_denied"
+	AuditReasonPolicyDenied         = "policy_denied"
+	AuditReasonError                = "error"
+)
+
+// AuditRecord is an authentication decision written to the audit log as a JSON line.
+// The schema is stable; fields may be added but are never renamed or removed.
+type AuditRecord struct {
+	SchemaVersion  int       `json:"schema_version"`
+	Time           time.Time `json:"time"`
+	Result         string    `json:"result"`
+	Method         string    `json:"method"`
+	Username       string    `json:"username"`
+	SFTPGoUsername string    `json:"sftpgo_username,omitempty"`
+	ClientIP       string    `json:"client_ip"`
+	Protocol       string    `json:"protocol,omitempty"`
+	KeyFingerprint string    `json:"key_fingerprint,omitempty"`
+	KeySource      string    `json:"key_source,omitempty"`
+	KeyLineNumber  int       `json:"key_line_number,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	LatencyMillis  int64     `json:"latency_ms"`
+}
+
+var (
+	auditLogPath  string
+	auditLogMutex sync.Mutex
+)
+
+// SetAuditLog enables the audit log in the log dir
+func SetAuditLog(logDir string) {
+	auditLogMutex.Lock()
+	defer auditLogMutex.Unlock()
+
+	auditLogPath = filepath.Join(logDir, auditLogFilename)
+}
+
+// WriteAuditRecord appends the record to the audit log, if enabled
+func WriteAuditRecord(record *AuditRecord) error {
+	auditLogMutex.Lock()
+	defer auditLogMutex.Unlock()
+
+	if len(auditLogPath) == 0 {
+		return nil
+	}
+
+	record.SchemaVersion = auditSchemaVersion
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// never truncate or rotate, other hook processes may append concurrently
+	auditFile, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, auditLogPermissions)
+	if err != nil {
+		return err
+	}
+	defer auditFile.Close()
+
+	// a single write per record keeps lines from interleaving
+	_, err = auditFile.Write(line)
+	return err
+}
@@ -0,0 +1,126 @@
+package commons
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteAuditRecord(t *testing.T) {
+	logDir := t.TempDir()
+	SetAuditLog(logDir)
+	t.Cleanup(func() {
+		auditLogPath = ""
+	})
+
+	records := []*AuditRecord{
+		{
+			Time:           time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Result:         AuditResultSuccess,
+			Method:         AuditMethodPublicKey,
+			Username:       "user1",
+			SFTPGoUsername: "user1_laptop",
+			ClientIP:       "192.0.2.1",
+			Protocol:       "SSH",
+			KeyFingerprint: "SHA256:abc",
+			KeySource:      "file",
+			KeyLineNumber:  3,
+			LatencyMillis:  12,
+		},
+		{
+			Time:     time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC),
+			Result:   AuditResultFailure,
+			Method:   AuditMethodPassword,
+			Username: "user1",
+			ClientIP: "192.0.2.1",
+			Reason:   AuditReasonInvalidCredentials,
+			Error:    "invalid credentials",
+		},
+	}
+
+	for _, record := range records {
+		err := WriteAuditRecord(record)
+		if err != nil {
+			t.Fatalf("failed to write an audit record: %v", err)
+		}
+	}
+
+	auditFile, err := os.Open(filepath.Join(logDir, auditLogFilename))
+	if err != nil {
+		t.Fatalf("failed to open the audit log: %v", err)
+	}
+	defer auditFile.Close()
+
+	fileInfo, err := auditFile.Stat()
+	if err != nil {
+		t.Fatalf("failed to stat the audit log: %v", err)
+	}
+	if fileInfo.Mode().Perm() != auditLogPermissions {
+		t.Errorf("audit log permissions = %o, want %o", fileInfo.Mode().Perm(), auditLogPermissions)
+	}
+
+	lines := []map[string]any{}
+	scanner := bufio.NewScanner(auditFile)
+	for scanner.Scan() {
+		line := map[string]any{}
+		err = json.Unmarshal(scanner.Bytes(), &line)
+		if err != nil {
+			t.Fatalf("audit log line %q is not JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != len(records) {
+		t.Fatalf("audit log has %d lines, want %d", len(lines), len(records))
+	}
+
+	// field names are the stable schema
+	wantSuccess := map[string]any{
+		"schema_version":  float64(auditSchemaVersion),
+		"time":            "2024-01-02T03:04:05Z",
+		"result":          "success",
+		"method":          "publickey",
+		"username":        "user1",
+		"sftpgo_username": "user1_laptop",
+		"client_ip":       "192.0.2.1",
+		"protocol":        "SSH",
+		"key_fingerprint": "SHA256:abc",
+		"key_source":      "file",
+		"key_line_number": float64(3),
+		"latency_ms":      float64(12),
+	}
+	wantFailure := map[string]any{
+		"schema_version": float64(auditSchemaVersion),
+		"time":           "2024-01-02T03:04:06Z",
+		"result":         "failure",
+		"method":         "password",
+		"username":       "user1",
+		"client_ip":      "192.0.2.1",
+		"reason":         "invalid_credentials",
+		"error":          "invalid credentials",
+		"latency_ms":     float64(0),
+	}
+
+	for i, want := range []map[string]any{wantSuccess, wantFailure} {
+		if len(lines[i]) != len(want) {
+			t.Errorf("line %d has fields %v, want %v", i+1, lines[i], want)
+		}
+		for field, value := range want {
+			if lines[i][field] != value {
+				t.Errorf("line %d field %s = %v, want %v", i+1, field, lines[i][field], value)
+			}
+		}
+	}
+}
+
+func TestWriteAuditRecordDisabled(t *testing.T) {
+	auditLogPath = ""
+
+	err := WriteAuditRecord(&AuditRecord{Result: AuditResultSuccess})
+	if err != nil {
+		t.Errorf("failed to skip a disabled audit log: %v", err)
+	}
+}
@@ -3,85 +3,281 @@ package commons
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"path/filepath"
+	"slices"
 	"strings"
-
-	"github.com/kelseyhightower/envconfig"
+	"time"
 )
 
 const (
-	defaultIRODSPort       int    = 1247
-	defaultIRODSAuthScheme string = "native"
-	defaultLogDir          string = "/tmp"
-	defaultHomeDir         string = "/srv/sftpgo/data"
+	defaultIRODSPort          int    = 1247
+	defaultIRODSAuthScheme    string = "native"
+	defaultLogDir             string = "/tmp"
+	defaultHomeDir            string = "/srv/sftpgo/data"
+	defaultSSLVerifyServer    string = "none"
+	defaultSecretFormat       string = "plain"
+	defaultAuthCacheTTL       int    = 300 // 5 mins
+	defaultLockoutThreshold   int    = 5
+	defaultLockoutDuration    int    = 60   // 1 min
+	defaultLockoutMaxDuration int    = 3600 // 1 hour
+	defaultProjectCollection  string = "/{zone}/home/shared/{group}"
+	defaultSharedWithMeMounts int    = 20
+	defaultSharedWithMeColls  int    = 1000
+	defaultPublicKeySource    string = "file"
+	defaultPublicKeyAVUName   string = "ssh-public-key"
+	defaultPublicKeyLocalDir  string = "/etc/sftpgo/authorized_keys.d"
 )
 
+// IRODSUserTypes are types of iRODS users that can log in
+var IRODSUserTypes = []string{"rodsuser", "rodsadmin", "groupadmin"}
+
+// SFTPGoProtocols are protocols that SFTPGo serves, as given in SFTPGO_AUTHD_PROTOCOL
+var SFTPGoProtocols = []string{"SSH", "FTP", "DAV", "HTTP"}
+
 // Config is a configuration struct
+// Fields can be given in a config file, using lower-cased env var names as keys, and env vars override them
 type Config struct {
 	// for public key auth
-	IRODSProxyUsername string `envconfig:"IRODS_PROXY_USER"`
-	IRODSProxyPassword string `envconfig:"IRODS_PROXY_PASSWORD"`
+	IRODSProxyUsername string `envconfig:"IRODS_PROXY_USER" yaml:"irods_proxy_user" json:"irods_proxy_user"`
+	IRODSProxyPassword string `envconfig:"IRODS_PROXY_PASSWORD" yaml:"irods_proxy_password" json:"irods_proxy_password"`
 
 	// for iRODS auth
-	IRODSHost string `envconfig:"IRODS_HOST"`
-	IRODSPort int    `envconfig:"IRODS_PORT"`
-	IRODSZone string `envconfig:"IRODS_ZONE"`
+	IRODSHost string `envconfig:"IRODS_HOST" yaml:"irods_host" json:"irods_host"`
+	// IRODSHosts are hosts tried in order when IRODSHost is not reachable
+	IRODSHosts []string `envconfig:"IRODS_HOSTS" yaml:"irods_hosts" json:"irods_hosts"`
+	IRODSPort  int      `envconfig:"IRODS_PORT" yaml:"irods_port" json:"irods_port"`
+	IRODSZone  string   `envconfig:"IRODS_ZONE" yaml:"irods_zone" json:"irods_zone"`
 	// IRODSAuthScheme should be one of ['native','pam','pam_for_users']
-	IRODSAuthScheme           string `envconfig:"IRODS_AUTH_SCHEME"`
-	IRODSRequireCSNegotiation bool   `envconfig:"IRODS_REQUIRE_CS_NEGOTIATION"`
+	IRODSAuthScheme           string `envconfig:"IRODS_AUTH_SCHEME" yaml:"irods_auth_scheme" json:"irods_auth_scheme"`
+	IRODSRequireCSNegotiation bool   `envconfig:"IRODS_REQUIRE_CS_NEGOTIATION" yaml:"irods_require_cs_negotiation" json:"irods_require_cs_negotiation"`
 	// IRODSCSNegotiationPolicy should be one of ['CS_NEG_REFUSE','CS_NEG_REQUIRE','CS_NEG_DONT_CARE']
-	IRODSCSNegotiationPolicy string `envconfig:"IRODS_CS_NEGOTIATION_POLICY"`
+	IRODSCSNegotiationPolicy string `envconfig:"IRODS_CS_NEGOTIATION_POLICY" yaml:"irods_cs_negotiation_policy" json:"irods_cs_negotiation_policy"`
+
+	// IRODSPAMOTPSeparator is put between password and one-time code when they are combined for PAM auth
+	// Passwords having it are taken as having a one-time code, and are not cached. PAM passwords are not cached without it
+	IRODSPAMOTPSeparator string `envconfig:"IRODS_PAM_OTP_SEPARATOR" yaml:"irods_pam_otp_separator" json:"irods_pam_otp_separator"`
+	// IRODSPAMSessionToken makes SFTPGo use a PAM token issued by iRODS, instead of the user's password or the proxy password
+	IRODSPAMSessionToken bool `envconfig:"IRODS_PAM_SESSION_TOKEN" yaml:"irods_pam_session_token" json:"irods_pam_session_token"`
+	// IRODSPAMTTL is a lifetime of PAM tokens in hours, 0 lets the server decide
+	// SFTPGo users given a session token expire with the token
+	IRODSPAMTTL int `envconfig:"IRODS_PAM_TTL" yaml:"irods_pam_ttl" json:"irods_pam_ttl"`
 
 	// for SSL/PAM auth
-	IRODSSSLCACertificatePath string `envconfig:"IRODS_SSL_CA_CERT_PATH"`
-	IRODSSSLAlgorithm         string `envconfig:"IRODS_SSL_ALGORITHM"`
-	IRODSSSLKeySize           int    `envconfig:"IRODS_SSL_KEY_SIZE"`
-	IRODSSSLSaltSize          int    `envconfig:"IRODS_SSL_SALT_SIZE"`
-	IRODSSSLHashRounds        int    `envconfig:"IRODS_SSL_HASH_ROUNDS"`
+	IRODSSSLCACertificatePath string `envconfig:"IRODS_SSL_CA_CERT_PATH" yaml:"irods_ssl_ca_cert_path" json:"irods_ssl_ca_cert_path"`
+	IRODSSSLAlgorithm         string `envconfig:"IRODS_SSL_ALGORITHM" yaml:"irods_ssl_algorithm" json:"irods_ssl_algorithm"`
+	IRODSSSLKeySize           int    `envconfig:"IRODS_SSL_KEY_SIZE" yaml:"irods_ssl_key_size" json:"irods_ssl_key_size"`
+	IRODSSSLSaltSize          int    `envconfig:"IRODS_SSL_SALT_SIZE" yaml:"irods_ssl_salt_size" json:"irods_ssl_salt_size"`
+	IRODSSSLHashRounds        int    `envconfig:"IRODS_SSL_HASH_ROUNDS" yaml:"irods_ssl_hash_rounds" json:"irods_ssl_hash_rounds"`
+	// IRODSSSLVerifyServer should be one of ['none','hostname'], 'none' if not given as before it is configurable
+	// Set 'hostname' to verify the server certificate and the host name, it requires CS_NEG_REQUIRE not to fall back to TCP.
+	// 'cert' is rejected, as the iRODS client cannot verify a certificate without the host name on its connection
+	IRODSSSLVerifyServer string `envconfig:"IRODS_SSL_VERIFY_SERVER" yaml:"irods_ssl_verify_server" json:"irods_ssl_verify_server"`
+	// IRODSSSLServerName overrides the server name used for SNI and hostname verification
+	IRODSSSLServerName string `envconfig:"IRODS_SSL_SERVER_NAME" yaml:"irods_ssl_server_name" json:"irods_ssl_server_name"`
 
 	// for fs mount
-	IRODSShared   string `envconfig:"IRODS_SHARED"`
-	SFTPGoHomeDir string `envconfig:"SFTPGO_HOME_PATH"`
+	IRODSShared   string `envconfig:"IRODS_SHARED" yaml:"irods_shared" json:"irods_shared"`
+	SFTPGoHomeDir string `envconfig:"SFTPGO_HOME_PATH" yaml:"sftpgo_home_path" json:"sftpgo_home_path"`
+	// SFTPGoSecretFormat should be one of ['plain','aes-256-gcm','secretbox'], for iRODS credentials given to SFTPGo
+	// Encrypted formats encrypt a data key with the master key, 'secretbox' is SFTPGo's local KMS format
+	SFTPGoSecretFormat string `envconfig:"SFTPGO_SECRET_FORMAT" yaml:"sftpgo_secret_format" json:"sftpgo_secret_format"`
+	// SFTPGoSecretMasterKeyPath is a path to the master key file of SFTPGo's local KMS, required for encrypted formats
+	SFTPGoSecretMasterKeyPath string `envconfig:"SFTPGO_SECRET_MASTER_KEY_PATH" yaml:"sftpgo_secret_master_key_path" json:"sftpgo_secret_master_key_path"`
+	// Mounts are templates of extra collections to mount, only given in a config file
+	Mounts []MountConfig `ignored:"true" yaml:"mounts" json:"mounts"`
+	// DisableDefaultMounts disables the home and shared mounts, so only Mounts are mounted
+	DisableDefaultMounts bool `envconfig:"SFTPGO_DISABLE_DEFAULT_MOUNTS" yaml:"sftpgo_disable_default_mounts" json:"sftpgo_disable_default_mounts"`
+	// ProjectMounts mounts a project collection for each iRODS group of the user, if the collection exists
+	ProjectMounts bool `envconfig:"SFTPGO_PROJECT_MOUNTS" yaml:"sftpgo_project_mounts" json:"sftpgo_project_mounts"`
+	// ProjectCollectionPath is a template of project collection paths, having {group} and optionally {zone}
+	ProjectCollectionPath string `envconfig:"SFTPGO_PROJECT_COLLECTION_PATH" yaml:"sftpgo_project_collection_path" json:"sftpgo_project_collection_path"`
+	// DisableACLPermissions grants all permissions on mounts, instead of deriving them from iRODS ACLs of the collections
+	// Deriving costs ACL queries per mount on every login, iRODS enforces ACLs anyway
+	DisableACLPermissions bool `envconfig:"SFTPGO_DISABLE_ACL_PERMISSIONS" yaml:"sftpgo_disable_acl_permissions" json:"sftpgo_disable_acl_permissions"`
+	// SharedWithMe mounts collections that other users share with the user by ACLs, under the shared_with_me dir
+	SharedWithMe bool `envconfig:"SFTPGO_SHARED_WITH_ME" yaml:"sftpgo_shared_with_me" json:"sftpgo_shared_with_me"`
+	// SharedWithMeMaxMounts is the max number of collections mounted under the shared_with_me dir
+	SharedWithMeMaxMounts int `envconfig:"SFTPGO_SHARED_WITH_ME_MAX_MOUNTS" yaml:"sftpgo_shared_with_me_max_mounts" json:"sftpgo_shared_with_me_max_mounts"`
+	// SharedWithMeMaxCollections is the max number of collections read from ACL queries for the shared_with_me dir, to bound query time
+	SharedWithMeMaxCollections int `envconfig:"SFTPGO_SHARED_WITH_ME_MAX_COLLECTIONS" yaml:"sftpgo_shared_with_me_max_collections" json:"sftpgo_shared_with_me_max_collections"`
+
+	// SFTP args, only given by env vars or auth requests
+	SFTPGoAuthdUsername  string `envconfig:"SFTPGO_AUTHD_USERNAME" yaml:"-" json:"-"`
+	SFTPGoAuthdPassword  string `envconfig:"SFTPGO_AUTHD_PASSWORD" yaml:"-" json:"-"`
+	SFTPGoAuthdPublickey string `envconfig:"SFTPGO_AUTHD_PUBLIC_KEY" yaml:"-" json:"-"`
+	SFTPGoAuthdIP        string `envconfig:"SFTPGO_AUTHD_IP" yaml:"-" json:"-"`
+	SFTPGoAuthdProtocol  string `envconfig:"SFTPGO_AUTHD_PROTOCOL" yaml:"-" json:"-"`
+	// SFTPGoAuthdKeyboardInteractive is not empty for keyboard interactive auth
+	SFTPGoAuthdKeyboardInteractive string `envconfig:"SFTPGO_AUTHD_KEYBOARD_INTERACTIVE" yaml:"-" json:"-"`
+
+	// AuthCacheDir is a dir to cache successful auth results, the cache is disabled if not given
+	// PAM passwords are cached only if IRODSPAMOTPSeparator is given, not to accept one-time codes again,
+	// and only with proxy or PAM session token, so that cached logins do not log in via PAM for catalog queries
+	AuthCacheDir string `envconfig:"SFTPGO_AUTH_CACHE_DIR" yaml:"sftpgo_auth_cache_dir" json:"sftpgo_auth_cache_dir"`
+	// AuthCacheTTL is how long successful auth results are cached, in seconds
+	AuthCacheTTL int `envconfig:"SFTPGO_AUTH_CACHE_TTL" yaml:"sftpgo_auth_cache_ttl" json:"sftpgo_auth_cache_ttl"`
 
-	// SFTP args
-	SFTPGoAuthdUsername  string `envconfig:"SFTPGO_AUTHD_USERNAME"`
-	SFTPGoAuthdPassword  string `envconfig:"SFTPGO_AUTHD_PASSWORD"`
-	SFTPGoAuthdPublickey string `envconfig:"SFTPGO_AUTHD_PUBLIC_KEY"`
-	SFTPGoAuthdIP        string `envconfig:"SFTPGO_AUTHD_IP"`
+	// LockoutDir is a dir to keep auth failure records, lockout is disabled if not given
+	LockoutDir string `envconfig:"SFTPGO_AUTH_LOCKOUT_DIR" yaml:"sftpgo_auth_lockout_dir" json:"sftpgo_auth_lockout_dir"`
+	// LockoutThreshold is the number of failures before a user or a client IP is locked out
+	LockoutThreshold int `envconfig:"SFTPGO_AUTH_LOCKOUT_THRESHOLD" yaml:"sftpgo_auth_lockout_threshold" json:"sftpgo_auth_lockout_threshold"`
+	// LockoutDuration is the first lockout duration in seconds, doubled for each further failure
+	LockoutDuration int `envconfig:"SFTPGO_AUTH_LOCKOUT_DURATION" yaml:"sftpgo_auth_lockout_duration" json:"sftpgo_auth_lockout_duration"`
+	// LockoutMaxDuration is the max lockout duration in seconds, failures older than this are forgotten
+	LockoutMaxDuration int `envconfig:"SFTPGO_AUTH_LOCKOUT_MAX_DURATION" yaml:"sftpgo_auth_lockout_max_duration" json:"sftpgo_auth_lockout_max_duration"`
+
+	// SFTPGoUserMaxLifetime is how long generated SFTPGo users are valid after login in seconds, no limit if 0
+	SFTPGoUserMaxLifetime int `envconfig:"SFTPGO_USER_MAX_LIFETIME" yaml:"sftpgo_user_max_lifetime" json:"sftpgo_user_max_lifetime"`
+
+	// SFTPGoAllowedProtocols are protocols users can log in over, all protocols if not given
+	SFTPGoAllowedProtocols []string `envconfig:"SFTPGO_ALLOWED_PROTOCOLS" yaml:"sftpgo_allowed_protocols" json:"sftpgo_allowed_protocols"`
+	// SFTPGoAllowedGroups are iRODS groups, users must be a member of any of them to log in, all users if not given
+	SFTPGoAllowedGroups []string `envconfig:"SFTPGO_ALLOWED_GROUPS" yaml:"sftpgo_allowed_groups" json:"sftpgo_allowed_groups"`
+	// SFTPGoDeniedGroups are iRODS groups, members of them cannot log in
+	SFTPGoDeniedGroups []string `envconfig:"SFTPGO_DENIED_GROUPS" yaml:"sftpgo_denied_groups" json:"sftpgo_denied_groups"`
+	// SFTPGoDeniedUserTypes are iRODS user types that cannot log in, such as rodsadmin
+	SFTPGoDeniedUserTypes []string `envconfig:"SFTPGO_DENIED_USER_TYPES" yaml:"sftpgo_denied_user_types" json:"sftpgo_denied_user_types"`
+	// GroupPolicies limit members of iRODS groups, only given in a config file
+	GroupPolicies []GroupPolicyConfig `ignored:"true" yaml:"group_policies" json:"group_policies"`
+
+	// PublicKeySources are where authorized public keys are read from, checked in order until a key matches
+	// "file" reads .ssh/authorized_keys in user's home, "avu" reads AVUs of the iRODS user,
+	// "local" reads a file in PublicKeyLocalDir and "http" requests PublicKeyHTTPURL
+	PublicKeySources []string `envconfig:"SFTPGO_PUBLIC_KEY_SOURCES" yaml:"sftpgo_public_key_sources" json:"sftpgo_public_key_sources"`
+	// PublicKeyAVUName is the attribute name of user AVUs having public keys
+	// The AVU value is an authorized_keys line, the units may have options of the key
+	PublicKeyAVUName string `envconfig:"SFTPGO_PUBLIC_KEY_AVU_NAME" yaml:"sftpgo_public_key_avu_name" json:"sftpgo_public_key_avu_name"`
+	// PublicKeyTimeZone is an IANA time zone of times in key options that have no zone, the server's local time zone if not given
+	PublicKeyTimeZone string `envconfig:"SFTPGO_PUBLIC_KEY_TIME_ZONE" yaml:"sftpgo_public_key_time_zone" json:"sftpgo_public_key_time_zone"`
+	// PublicKeyLocalDir is a dir having authorized_keys files named by user names
+	PublicKeyLocalDir string `envconfig:"SFTPGO_PUBLIC_KEY_LOCAL_DIR" yaml:"sftpgo_public_key_local_dir" json:"sftpgo_public_key_local_dir"`
+	// PublicKeyHTTPURL is a URL returning authorized_keys text, {username} in the URL is replaced by the user name
+	PublicKeyHTTPURL string `envconfig:"SFTPGO_PUBLIC_KEY_HTTP_URL" yaml:"sftpgo_public_key_http_url" json:"sftpgo_public_key_http_url"`
 
 	// for Logging
-	SFTPGoLogDir string `envconfig:"SFTPGO_LOG_DIR"`
+	SFTPGoLogDir string `envconfig:"SFTPGO_LOG_DIR" yaml:"sftpgo_log_dir" json:"sftpgo_log_dir"`
+
+	// sources has where each field value came from, by field name
+	sources map[string]string
 }
 
 func GetDefaultLogPath() string {
 	return defaultLogDir
 }
 
+// ReadFromEnv reads config from env vars
 func ReadFromEnv() (*Config, error) {
-	var config Config
-	err := envconfig.Process("", &config)
+	return ReadConfig("")
+}
+
+// ReadConfig reads config from a config file at configPath, if given, and env vars
+// Env vars override values in the config file
+func ReadConfig(configPath string) (*Config, error) {
+	config := Config{
+		sources: map[string]string{},
+	}
+
+	if len(configPath) > 0 {
+		err := readConfigFile(configPath, &config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := readConfigEnv(&config)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(config.IRODSHost) == 0 && len(config.IRODSHosts) > 0 {
+		config.IRODSHost = config.IRODSHosts[0]
+		config.sources["IRODSHost"] = config.sources["IRODSHosts"]
+	}
+
 	if config.IRODSPort == 0 {
 		config.IRODSPort = defaultIRODSPort
+		config.sources["IRODSPort"] = configSourceDefault
 	}
 
 	if len(config.IRODSAuthScheme) == 0 {
 		config.IRODSAuthScheme = defaultIRODSAuthScheme
+		config.sources["IRODSAuthScheme"] = configSourceDefault
 	}
 
 	if len(config.IRODSCSNegotiationPolicy) == 0 {
 		config.IRODSCSNegotiationPolicy = "CS_NEG_DONT_CARE"
+		config.sources["IRODSCSNegotiationPolicy"] = configSourceDefault
+	}
+
+	if len(config.IRODSSSLVerifyServer) == 0 {
+		config.IRODSSSLVerifyServer = defaultSSLVerifyServer
+		config.sources["IRODSSSLVerifyServer"] = configSourceDefault
+	}
+
+	if len(config.SFTPGoSecretFormat) == 0 {
+		config.SFTPGoSecretFormat = defaultSecretFormat
+		config.sources["SFTPGoSecretFormat"] = configSourceDefault
+	}
+
+	if config.AuthCacheTTL == 0 {
+		config.AuthCacheTTL = defaultAuthCacheTTL
+		config.sources["AuthCacheTTL"] = configSourceDefault
+	}
+
+	if config.LockoutThreshold == 0 {
+		config.LockoutThreshold = defaultLockoutThreshold
+		config.sources["LockoutThreshold"] = configSourceDefault
+	}
+
+	if config.LockoutDuration == 0 {
+		config.LockoutDuration = defaultLockoutDuration
+		config.sources["LockoutDuration"] = configSourceDefault
+	}
+
+	if config.LockoutMaxDuration == 0 {
+		config.LockoutMaxDuration = defaultLockoutMaxDuration
+		config.sources["LockoutMaxDuration"] = configSourceDefault
+	}
+
+	if len(config.ProjectCollectionPath) == 0 {
+		config.ProjectCollectionPath = defaultProjectCollection
+		config.sources["ProjectCollectionPath"] = configSourceDefault
+	}
+
+	if config.SharedWithMeMaxMounts == 0 {
+		config.SharedWithMeMaxMounts = defaultSharedWithMeMounts
+		config.sources["SharedWithMeMaxMounts"] = configSourceDefault
+	}
+
+	if config.SharedWithMeMaxCollections == 0 {
+		config.SharedWithMeMaxCollections = defaultSharedWithMeColls
+		config.sources["SharedWithMeMaxCollections"] = configSourceDefault
+	}
+
+	if len(config.PublicKeySources) == 0 {
+		config.PublicKeySources = []string{defaultPublicKeySource}
+		config.sources["PublicKeySources"] = configSourceDefault
+	}
+
+	if len(config.PublicKeyAVUName) == 0 {
+		config.PublicKeyAVUName = defaultPublicKeyAVUName
+		config.sources["PublicKeyAVUName"] = configSourceDefault
+	}
+
+	if len(config.PublicKeyLocalDir) == 0 {
+		config.PublicKeyLocalDir = defaultPublicKeyLocalDir
+		config.sources["PublicKeyLocalDir"] = configSourceDefault
 	}
 
 	if len(config.SFTPGoLogDir) == 0 {
 		config.SFTPGoLogDir = defaultLogDir
+		config.sources["SFTPGoLogDir"] = configSourceDefault
 	}
 
 	if len(config.SFTPGoHomeDir) == 0 {
 		config.SFTPGoHomeDir = defaultHomeDir
+		config.sources["SFTPGoHomeDir"] = configSourceDefault
 	}
 
 	return &config, nil
@@ -89,81 +285,254 @@ func ReadFromEnv() (*Config, error) {
 
 // Validate validates field values and returns error if occurs
 func (config *Config) Validate() error {
+	err := config.ValidateForServe()
+	if err != nil {
+		return err
+	}
+
+	if len(config.SFTPGoAuthdUsername) == 0 {
+		return errors.New("user name is not given")
+	}
+	if !config.IsKeyboardInteractiveAuth() && len(config.SFTPGoAuthdPublickey) == 0 && len(config.SFTPGoAuthdPassword) == 0 {
+		return errors.New("at least any of password or public key must be given")
+	}
+	if len(config.SFTPGoAuthdIP) == 0 {
+		return errors.New("ip address is not given")
+	}
+	return nil
+}
+
+// ValidateForServe validates field values that do not come from an auth request and returns error if occurs
+// Errors tell where the invalid value came from
+func (config *Config) ValidateForServe() error {
 	if len(config.IRODSHost) == 0 {
-		return errors.New("iRODS host is not given")
+		return config.fieldError("IRODSHost", "iRODS host is not given")
+	}
+	for _, host := range config.IRODSHosts {
+		if len(host) == 0 {
+			return config.fieldError("IRODSHosts", "iRODS host must not be empty")
+		}
 	}
 	if config.IRODSPort <= 0 {
-		return errors.New("iRODS port must not be negative")
+		return config.fieldError("IRODSPort", "iRODS port must not be negative")
 	}
 	if len(config.IRODSZone) == 0 {
-		return errors.New("iRODS zone is not given")
+		return config.fieldError("IRODSZone", "iRODS zone is not given")
 	}
 	if len(config.IRODSAuthScheme) == 0 {
-		return errors.New("iRODS auth scheme is not given")
+		return config.fieldError("IRODSAuthScheme", "iRODS auth scheme is not given")
 	}
 	if config.IRODSRequireCSNegotiation {
 		if len(config.IRODSCSNegotiationPolicy) == 0 {
-			return errors.New("iRODS client-server negotiation policy is not given")
+			return config.fieldError("IRODSCSNegotiationPolicy", "iRODS client-server negotiation policy is not given")
 		}
 
 		if strings.ToLower(config.IRODSCSNegotiationPolicy) == "cs_neg_require" {
 			// SSL
-			if len(config.IRODSSSLCACertificatePath) == 0 {
-				return errors.New("iRODS SSL CA certificate path is not given")
-			}
-			if len(config.IRODSSSLAlgorithm) == 0 {
-				return errors.New("iRODS SSL encryption algorithm is not given")
-			}
-			if config.IRODSSSLKeySize <= 0 {
-				return errors.New("iRODS SSL encryption key size is not given")
-			}
-			if config.IRODSSSLSaltSize <= 0 {
-				return errors.New("iRODS SSL encryption salt size is not given")
-			}
-			if config.IRODSSSLHashRounds <= 0 {
-				return errors.New("iRODS SSL encryption hash rounds is not given")
+			err := config.validateSSL()
+			if err != nil {
+				return err
 			}
 		}
 	}
-	if strings.ToLower(config.IRODSAuthScheme) == "pam" || strings.ToLower(config.IRODSAuthScheme) == "pam_for_users" {
+	if config.IsPAMAuth() {
 		if !config.IRODSRequireCSNegotiation {
-			return errors.New("iRODS client-server negotiation is not given for PAM authentication")
+			return config.fieldError("IRODSRequireCSNegotiation", "iRODS client-server negotiation is not given for PAM authentication")
 		}
 		if len(config.IRODSCSNegotiationPolicy) == 0 {
-			return errors.New("iRODS client-server negotiation policy is not given for PAM authentication")
+			return config.fieldError("IRODSCSNegotiationPolicy", "iRODS client-server negotiation policy is not given for PAM authentication")
+		}
+
+		err := config.validateSSL()
+		if err != nil {
+			return err
 		}
+	}
+	if config.IRODSPAMSessionToken && !config.IsPAMAuth() {
+		return config.fieldError("IRODSPAMSessionToken", fmt.Sprintf("iRODS PAM session token requires PAM auth scheme, but %s is given", config.IRODSAuthScheme))
+	}
+	if config.IRODSPAMTTL < 0 {
+		return config.fieldError("IRODSPAMTTL", "iRODS PAM TTL must not be negative")
+	}
+
+	err := config.validateSSLVerification()
+	if err != nil {
+		return err
+	}
+
+	err = config.validateMounts()
+	if err != nil {
+		return err
+	}
+
+	err = config.validateProjectMounts()
+	if err != nil {
+		return err
+	}
+
+	if config.SharedWithMe && config.SharedWithMeMaxMounts <= 0 {
+		return config.fieldError("SharedWithMeMaxMounts", "shared with me max mounts must be positive")
+	}
+
+	if config.SharedWithMe && config.SharedWithMeMaxCollections <= 0 {
+		return config.fieldError("SharedWithMeMaxCollections", "shared with me max collections must be positive")
+	}
 
-		if len(config.IRODSSSLCACertificatePath) == 0 {
-			return errors.New("iRODS SSL CA certificate path is not given")
+	switch strings.ToLower(config.SFTPGoSecretFormat) {
+	case "plain":
+	case "aes-256-gcm":
+		if len(config.SFTPGoSecretMasterKeyPath) == 0 {
+			return config.fieldError("SFTPGoSecretMasterKeyPath", "master key path is not given for aes-256-gcm secret format, a data key stored without a master key does not protect the secret, use secretbox with a master key")
 		}
-		if len(config.IRODSSSLAlgorithm) == 0 {
-			return errors.New("iRODS SSL encryption algorithm is not given")
+	case "secretbox":
+		if len(config.SFTPGoSecretMasterKeyPath) == 0 {
+			return config.fieldError("SFTPGoSecretMasterKeyPath", fmt.Sprintf("master key path is not given for %s secret format", config.SFTPGoSecretFormat))
 		}
-		if config.IRODSSSLKeySize <= 0 {
-			return errors.New("iRODS SSL encryption key size is not given")
+	default:
+		return config.fieldError("SFTPGoSecretFormat", fmt.Sprintf("secret format must be one of plain, aes-256-gcm or secretbox, but %q is given", config.SFTPGoSecretFormat))
+	}
+
+	if config.AuthCacheTTL < 0 {
+		return config.fieldError("AuthCacheTTL", "auth cache TTL must not be negative")
+	}
+
+	if config.IsLockoutEnabled() {
+		if config.LockoutThreshold <= 0 {
+			return config.fieldError("LockoutThreshold", "lockout threshold must be positive")
 		}
-		if config.IRODSSSLSaltSize <= 0 {
-			return errors.New("iRODS SSL encryption salt size is not given")
+		if config.LockoutDuration <= 0 {
+			return config.fieldError("LockoutDuration", "lockout duration must be positive")
 		}
-		if config.IRODSSSLHashRounds <= 0 {
-			return errors.New("iRODS SSL encryption hash rounds is not given")
+		if config.LockoutMaxDuration < config.LockoutDuration {
+			return config.fieldError("LockoutMaxDuration", "lockout max duration must not be shorter than lockout duration")
 		}
 	}
 
-	if len(config.SFTPGoAuthdUsername) == 0 {
-		return errors.New("user name is not given")
+	if config.SFTPGoUserMaxLifetime < 0 {
+		return config.fieldError("SFTPGoUserMaxLifetime", "user max lifetime must not be negative")
 	}
-	if len(config.SFTPGoAuthdPublickey) == 0 && len(config.SFTPGoAuthdPassword) == 0 {
-		return errors.New("at least any of password or public key must be given")
+
+	for _, protocol := range config.SFTPGoAllowedProtocols {
+		if !IsSFTPGoProtocol(protocol) {
+			return config.fieldError("SFTPGoAllowedProtocols", fmt.Sprintf("protocol must be one of %s, but %q is given", strings.Join(SFTPGoProtocols, ", "), protocol))
+		}
 	}
-	if len(config.SFTPGoAuthdIP) == 0 {
-		return errors.New("ip address is not given")
+
+	for _, group := range config.SFTPGoAllowedGroups {
+		if len(group) == 0 {
+			return config.fieldError("SFTPGoAllowedGroups", "allowed group must not be empty")
+		}
+	}
+	for _, group := range config.SFTPGoDeniedGroups {
+		if len(group) == 0 {
+			return config.fieldError("SFTPGoDeniedGroups", "denied group must not be empty")
+		}
+	}
+
+	for _, userType := range config.SFTPGoDeniedUserTypes {
+		if !slices.Contains(IRODSUserTypes, strings.ToLower(userType)) {
+			return config.fieldError("SFTPGoDeniedUserTypes", fmt.Sprintf("user type must be one of %s, but %q is given", strings.Join(IRODSUserTypes, ", "), userType))
+		}
 	}
+
+	err = config.validateGroupPolicies()
+	if err != nil {
+		return err
+	}
+
+	err = config.validatePublicKeySources()
+	if err != nil {
+		return err
+	}
+
+	if len(config.PublicKeyTimeZone) > 0 {
+		_, err = time.LoadLocation(config.PublicKeyTimeZone)
+		if err != nil {
+			return config.fieldError("PublicKeyTimeZone", fmt.Sprintf("unknown time zone %q", config.PublicKeyTimeZone))
+		}
+	}
+
 	if len(config.SFTPGoLogDir) == 0 {
-		return errors.New("log dir is not given")
+		return config.fieldError("SFTPGoLogDir", "log dir is not given")
 	}
 	if len(config.SFTPGoHomeDir) == 0 {
-		return errors.New("home dir is not given")
+		return config.fieldError("SFTPGoHomeDir", "home dir is not given")
+	}
+	return nil
+}
+
+func (config *Config) validateSSL() error {
+	if len(config.IRODSSSLCACertificatePath) == 0 {
+		return config.fieldError("IRODSSSLCACertificatePath", "iRODS SSL CA certificate path is not given")
+	}
+	if len(config.IRODSSSLAlgorithm) == 0 {
+		return config.fieldError("IRODSSSLAlgorithm", "iRODS SSL encryption algorithm is not given")
+	}
+	if config.IRODSSSLKeySize <= 0 {
+		return config.fieldError("IRODSSSLKeySize", "iRODS SSL encryption key size is not given")
+	}
+	if config.IRODSSSLSaltSize <= 0 {
+		return config.fieldError("IRODSSSLSaltSize", "iRODS SSL encryption salt size is not given")
+	}
+	if config.IRODSSSLHashRounds <= 0 {
+		return config.fieldError("IRODSSSLHashRounds", "iRODS SSL encryption hash rounds is not given")
+	}
+	return nil
+}
+
+func (config *Config) validateSSLVerification() error {
+	switch strings.ToLower(config.IRODSSSLVerifyServer) {
+	case "none":
+		if len(config.IRODSSSLServerName) > 0 && !config.IsSSLRequired() {
+			return config.fieldError("IRODSSSLServerName", "iRODS SSL server name requires client-server negotiation policy CS_NEG_REQUIRE")
+		}
+	case "hostname":
+		// with other policies, the server can fall back to TCP and nothing is verified
+		if !config.IsSSLRequired() {
+			return config.fieldError("IRODSSSLVerifyServer", "iRODS SSL server verification 'hostname' requires client-server negotiation policy CS_NEG_REQUIRE")
+		}
+	case "cert":
+		return config.fieldError("IRODSSSLVerifyServer", "iRODS SSL server verification 'cert' is not supported, as the iRODS client only verifies certificates in 'hostname' mode, use 'hostname' with IRODSSSLServerName instead")
+	default:
+		return config.fieldError("IRODSSSLVerifyServer", fmt.Sprintf("iRODS SSL server verification must be one of none or hostname, but %q is given", config.IRODSSSLVerifyServer))
+	}
+	return nil
+}
+
+func (config *Config) validatePublicKeySources() error {
+	if len(config.PublicKeySources) == 0 {
+		return config.fieldError("PublicKeySources", "public key source is not given")
+	}
+
+	sources := map[string]bool{}
+	for _, source := range config.PublicKeySources {
+		switch strings.ToLower(source) {
+		case "file", "avu", "local", "http":
+		default:
+			return config.fieldError("PublicKeySources", fmt.Sprintf("public key source must be one of file, avu, local or http, but %q is given", source))
+		}
+
+		if sources[strings.ToLower(source)] {
+			return config.fieldError("PublicKeySources", fmt.Sprintf("public key source %q is duplicated", source))
+		}
+		sources[strings.ToLower(source)] = true
+	}
+
+	if sources["avu"] && len(config.PublicKeyAVUName) == 0 {
+		return config.fieldError("PublicKeyAVUName", "public key AVU name is not given")
+	}
+	if sources["local"] && len(config.PublicKeyLocalDir) == 0 {
+		return config.fieldError("PublicKeyLocalDir", "public key local dir is not given")
+	}
+	if sources["http"] {
+		if len(config.PublicKeyHTTPURL) == 0 {
+			return config.fieldError("PublicKeyHTTPURL", "public key HTTP URL is not given")
+		}
+
+		keyURL, err := url.Parse(config.PublicKeyHTTPURL)
+		if err != nil || (keyURL.Scheme != "http" && keyURL.Scheme != "https") || len(keyURL.Host) == 0 {
+			return config.fieldError("PublicKeyHTTPURL", fmt.Sprintf("public key HTTP URL %q is not a valid http or https URL", config.PublicKeyHTTPURL))
+		}
 	}
 	return nil
 }
@@ -180,6 +549,26 @@ func (config *Config) ValidateForPublicKeyAuth() error {
 	return nil
 }
 
+// ValidateForKeyboardInteractiveAuth validates field values and returns error if occurs
+func (config *Config) ValidateForKeyboardInteractiveAuth() error {
+	if config.IsAnonymousUser() {
+		return errors.New("anonymous user cannot use keyboard interactive authentication")
+	}
+
+	if !config.IsPAMAuth() {
+		return fmt.Errorf("keyboard interactive authentication requires PAM auth scheme, but %s is given", config.IRODSAuthScheme)
+	}
+
+	// one-time code cannot be reused to access iRODS after auth, e.g., to create .ssh dir or look up groups.
+	// SFTPGo always gets proxy credentials here, PAM session token is not requested.
+	return config.ValidateForPublicKeyAuth()
+}
+
+// IsKeyboardInteractiveAuth checks if the auth mode is keyboard interactive auth
+func (config *Config) IsKeyboardInteractiveAuth() bool {
+	return len(config.SFTPGoAuthdKeyboardInteractive) > 0
+}
+
 // IsPublicKeyAuth checks if the auth mode is public key auth
 func (config *Config) IsPublicKeyAuth() bool {
 	if config.IsAnonymousUser() {
@@ -189,6 +578,27 @@ func (config *Config) IsPublicKeyAuth() bool {
 	return len(config.SFTPGoAuthdPublickey) > 0
 }
 
+// IsAuthCacheEnabled checks if successful auth results are cached
+func (config *Config) IsAuthCacheEnabled() bool {
+	return len(config.AuthCacheDir) > 0 && config.AuthCacheTTL > 0
+}
+
+// IsLockoutEnabled checks if users and client IPs are locked out after repeated failures
+func (config *Config) IsLockoutEnabled() bool {
+	return len(config.LockoutDir) > 0
+}
+
+// IsSSLRequired checks if connections to iRODS must use SSL
+func (config *Config) IsSSLRequired() bool {
+	return config.IRODSRequireCSNegotiation && strings.ToLower(config.IRODSCSNegotiationPolicy) == "cs_neg_require"
+}
+
+// IsPAMAuth checks if users are authenticated with PAM
+func (config *Config) IsPAMAuth() bool {
+	authScheme := strings.ToLower(config.IRODSAuthScheme)
+	return authScheme == "pam" || authScheme == "pam_for_users"
+}
+
 // IsAnonymousUser checks if the user is anonymous
 func (config *Config) IsAnonymousUser() bool {
 	return strings.ToLower(config.SFTPGoAuthdUsername) == "anonymous"
@@ -204,7 +614,60 @@ func (config *Config) HasSharedDir() bool {
 	return len(config.IRODSShared) > 0
 }
 
-// GetSharedDirName returns shared dir's name
+// IsSFTPGoProtocol checks if the protocol is served by SFTPGo, case-insensitively
+func IsSFTPGoProtocol(protocol string) bool {
+	for _, sftpgoProtocol := range SFTPGoProtocols {
+		if strings.EqualFold(protocol, sftpgoProtocol) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAllowedProtocols returns upper-cased protocols users can log in over, nil if not limited
+func (config *Config) GetAllowedProtocols() []string {
+	if len(config.SFTPGoAllowedProtocols) == 0 {
+		return nil
+	}
+
+	protocols := []string{}
+	for _, protocol := range config.SFTPGoAllowedProtocols {
+		protocols = append(protocols, strings.ToUpper(protocol))
+	}
+	return protocols
+}
+
+// IsAccessPolicyEnabled checks if users are allowed or denied by groups or user types
+func (config *Config) IsAccessPolicyEnabled() bool {
+	return len(config.SFTPGoAllowedGroups) > 0 || len(config.SFTPGoDeniedGroups) > 0 || len(config.SFTPGoDeniedUserTypes) > 0
+}
+
+// GetPublicKeyTimeLocation returns the location of times in key options that have no zone
+func (config *Config) GetPublicKeyTimeLocation() *time.Location {
+	if len(config.PublicKeyTimeZone) == 0 {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(config.PublicKeyTimeZone)
+	if err != nil {
+		// validated already
+		return time.Local
+	}
+	return location
+}
+
+// GetIRODSHosts returns iRODS hosts to try in order
+func (config *Config) GetIRODSHosts() []string {
+	hosts := []string{config.IRODSHost}
+	for _, host := range config.IRODSHosts {
+		if host != config.IRODSHost {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// GetHomeDirPath returns user's home dir path
 func (config *Config) GetHomeDirPath() string {
 	if config.IsAnonymousUser() {
 		return ""
@@ -0,0 +1,114 @@
+package commons
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configSourceDefault string = "default"
+)
+
+// readConfigFile reads a YAML or JSON config file into config
+// Files with .json extension are read as JSON, others as YAML
+func readConfigFile(configPath string, config *Config) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %q: %w", configPath, err)
+	}
+
+	// keys given in the file, to tell the source of field values
+	keys := map[string]interface{}{}
+
+	if strings.ToLower(filepath.Ext(configPath)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %q: %w", configPath, err)
+		}
+
+		err = json.Unmarshal(data, &keys)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %q: %w", configPath, err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %q: %w", configPath, err)
+		}
+
+		err = yaml.Unmarshal(data, &keys)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %q: %w", configPath, err)
+		}
+	}
+
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if _, ok := keys[getConfigFileKey(field)]; ok {
+			config.sources[field.Name] = fmt.Sprintf("config file %s", configPath)
+		}
+	}
+
+	return nil
+}
+
+// readConfigEnv reads env vars into config, keeping values of fields that have no env var set
+func readConfigEnv(config *Config) error {
+	err := envconfig.Process("", config)
+	if err != nil {
+		return err
+	}
+
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		envName := field.Tag.Get("envconfig")
+		if len(envName) == 0 {
+			continue
+		}
+
+		if _, ok := os.LookupEnv(envName); ok {
+			config.sources[field.Name] = fmt.Sprintf("env %s", envName)
+		}
+	}
+
+	return nil
+}
+
+// getConfigFileKey returns a key of the field in config files
+func getConfigFileKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return key
+}
+
+// fieldError returns an error for an invalid field value, telling where the value came from
+func (config *Config) fieldError(fieldName string, message string) error {
+	if source, ok := config.sources[fieldName]; ok {
+		return fmt.Errorf("%s (from %s)", message, source)
+	}
+
+	field, ok := reflect.TypeOf(Config{}).FieldByName(fieldName)
+	if !ok {
+		return fmt.Errorf("%s", message)
+	}
+
+	envName := field.Tag.Get("envconfig")
+	fileKey := getConfigFileKey(field)
+	if len(envName) == 0 {
+		return fmt.Errorf("%s (set %q in config file)", message, fileKey)
+	}
+	return fmt.Errorf("%s (set env %s or %q in config file)", message, envName, fileKey)
+}
@@ -0,0 +1,216 @@
+package commons
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfigYAML = `irods_hosts: [irods1.example.com, irods2.example.com]
+irods_zone: zone
+mounts:
+  - name: lab_{group}
+    dir_name: "{group}"
+    collection_path: /{zone}/labs/{group}
+group_policies:
+  - group: guests
+    allowed_protocols: [DAV]
+    readonly: true
+`
+
+func writeTestConfig(t *testing.T, name string, content string) string {
+	configPath := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(configPath, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return configPath
+}
+
+func TestReadConfig(t *testing.T) {
+	configPath := writeTestConfig(t, "config.yaml", testConfigYAML)
+	t.Setenv("IRODS_ZONE", "envzone")
+
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+
+	if config.IRODSHost != "irods1.example.com" {
+		t.Errorf("iRODS host = %q, want the first of hosts", config.IRODSHost)
+	}
+	if config.IRODSZone != "envzone" {
+		t.Errorf("iRODS zone = %q, env vars must override the file", config.IRODSZone)
+	}
+	if len(config.Mounts) != 1 || config.Mounts[0].Name != "lab_{group}" {
+		t.Errorf("mounts = %+v", config.Mounts)
+	}
+	if len(config.GroupPolicies) != 1 || config.GroupPolicies[0].Group != "guests" || !config.GroupPolicies[0].ReadOnly {
+		t.Errorf("group policies = %+v", config.GroupPolicies)
+	}
+
+	// defaults
+	if config.IRODSPort != defaultIRODSPort {
+		t.Errorf("iRODS port = %d, want %d", config.IRODSPort, defaultIRODSPort)
+	}
+	if config.DisableACLPermissions {
+		t.Errorf("ACL permissions are disabled by default")
+	}
+	if config.SharedWithMeMaxCollections != defaultSharedWithMeColls {
+		t.Errorf("shared with me max collections = %d", config.SharedWithMeMaxCollections)
+	}
+
+	err = config.ValidateForServe()
+	if err != nil {
+		t.Errorf("config is not valid: %v", err)
+	}
+}
+
+func TestReadConfigUnknownKey(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.json"} {
+		t.Run(name, func(t *testing.T) {
+			content := "irods_zone: zone\nbogus: 1\n"
+			if strings.HasSuffix(name, ".json") {
+				content = `{"irods_zone": "zone", "bogus": 1}`
+			}
+
+			_, err := ReadConfig(writeTestConfig(t, name, content))
+			if err == nil {
+				t.Errorf("unknown key is accepted")
+			}
+		})
+	}
+}
+
+// setTestSSLRequired makes the config require SSL connections to iRODS
+func setTestSSLRequired(config *Config) {
+	config.IRODSRequireCSNegotiation = true
+	config.IRODSCSNegotiationPolicy = "CS_NEG_REQUIRE"
+	config.IRODSSSLCACertificatePath = "/etc/ssl/certs"
+	config.IRODSSSLAlgorithm = "AES-256-CBC"
+	config.IRODSSSLKeySize = 32
+	config.IRODSSSLSaltSize = 8
+	config.IRODSSSLHashRounds = 16
+}
+
+func TestValidateForServe(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(config *Config)
+		wantErr string
+	}{
+		{"valid", func(config *Config) {}, ""},
+		{"no zone", func(config *Config) { config.IRODSZone = "" }, "zone is not given"},
+		{"negative port", func(config *Config) { config.IRODSPort = -1 }, "port"},
+		{"unknown protocol", func(config *Config) { config.SFTPGoAllowedProtocols = []string{"SMB"} }, "protocol must be one of"},
+		{"group policy without group", func(config *Config) {
+			config.GroupPolicies = []GroupPolicyConfig{{ReadOnly: true}}
+		}, "has no group"},
+		{"duplicated group policy", func(config *Config) {
+			config.GroupPolicies = []GroupPolicyConfig{{Group: "a"}, {Group: "a"}}
+		}, "duplicated"},
+		{"group policy with unknown protocol", func(config *Config) {
+			config.GroupPolicies = []GroupPolicyConfig{{Group: "a", AllowedProtocols: []string{"SMB"}}}
+		}, "has protocol"},
+		{"group policy with negative lifetime", func(config *Config) {
+			config.GroupPolicies = []GroupPolicyConfig{{Group: "a", UserMaxLifetime: -1}}
+		}, "negative user max lifetime"},
+		{"group placeholder only in collection path", func(config *Config) {
+			config.Mounts = []MountConfig{{Name: "lab", DirName: "lab", CollectionPath: "/{zone}/labs/{group}"}}
+		}, "not in both"},
+		{"unknown placeholder", func(config *Config) {
+			config.Mounts = []MountConfig{{Name: "lab", DirName: "lab", CollectionPath: "/{zone}/{project}"}}
+		}, "unknown placeholder"},
+		{"duplicated mount name", func(config *Config) {
+			config.Mounts = []MountConfig{{Name: "lab", DirName: "a", CollectionPath: "/zone/a"}, {Name: "lab", DirName: "b", CollectionPath: "/zone/b"}}
+		}, "duplicated"},
+		{"relative collection path", func(config *Config) {
+			config.Mounts = []MountConfig{{Name: "lab", DirName: "lab", CollectionPath: "labs"}}
+		}, "not absolute"},
+		{"invalid dir name", func(config *Config) {
+			config.Mounts = []MountConfig{{Name: "lab", DirName: "a/b", CollectionPath: "/zone/labs"}}
+		}, "invalid dir name"},
+		{"unknown mount users", func(config *Config) {
+			config.Mounts = []MountConfig{{Name: "lab", DirName: "lab", CollectionPath: "/zone/labs", When: MountCondition{Users: "guests"}}}
+		}, "users condition"},
+		{"unknown mount auth method", func(config *Config) {
+			config.Mounts = []MountConfig{{Name: "lab", DirName: "lab", CollectionPath: "/zone/labs", When: MountCondition{AuthMethods: []string{"gssapi"}}}}
+		}, "auth method condition"},
+		{"project collection without group", func(config *Config) {
+			config.ProjectMounts = true
+			config.ProjectCollectionPath = "/{zone}/projects"
+		}, "does not have {group}"},
+		{"non-positive shared with me max collections", func(config *Config) {
+			config.SharedWithMe = true
+			config.SharedWithMeMaxCollections = -1
+		}, "max collections must be positive"},
+		{"hostname verification", func(config *Config) {
+			setTestSSLRequired(config)
+			config.IRODSSSLVerifyServer = "hostname"
+			config.IRODSSSLServerName = "irods.internal"
+		}, ""},
+		{"hostname verification without SSL", func(config *Config) {
+			config.IRODSSSLVerifyServer = "hostname"
+		}, "requires client-server negotiation policy CS_NEG_REQUIRE"},
+		{"hostname verification falling back to TCP", func(config *Config) {
+			setTestSSLRequired(config)
+			config.IRODSCSNegotiationPolicy = "CS_NEG_DONT_CARE"
+			config.IRODSSSLVerifyServer = "hostname"
+		}, "requires client-server negotiation policy CS_NEG_REQUIRE"},
+		{"server name without SSL", func(config *Config) {
+			config.IRODSSSLServerName = "irods.internal"
+		}, "requires client-server negotiation policy CS_NEG_REQUIRE"},
+		{"cert verification", func(config *Config) {
+			setTestSSLRequired(config)
+			config.IRODSSSLVerifyServer = "cert"
+		}, "'cert' is not supported"},
+		{"aes-256-gcm secret without master key", func(config *Config) {
+			config.SFTPGoSecretFormat = "aes-256-gcm"
+		}, "use secretbox with a master key"},
+		{"aes-256-gcm secret with master key", func(config *Config) {
+			config.SFTPGoSecretFormat = "aes-256-gcm"
+			config.SFTPGoSecretMasterKeyPath = "/etc/sftpgo/master.key"
+		}, ""},
+		{"unknown verification", func(config *Config) {
+			config.IRODSSSLVerifyServer = "strict"
+		}, "must be one of none or hostname"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := ReadConfig(writeTestConfig(t, "config.yaml", "irods_host: irods.example.com\nirods_zone: zone\n"))
+			if err != nil {
+				t.Fatalf("failed to read config: %v", err)
+			}
+
+			test.modify(config)
+
+			err = config.ValidateForServe()
+			if len(test.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("config is not valid: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("err = %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestFieldErrorTellsSource(t *testing.T) {
+	configPath := writeTestConfig(t, "config.yaml", "irods_host: irods.example.com\nirods_zone: zone\nirods_port: -1\n")
+
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+
+	err = config.ValidateForServe()
+	if err == nil || !strings.Contains(err.Error(), "config file "+configPath) {
+		t.Errorf("err = %v, want the config file as the source", err)
+	}
+}
@@ -0,0 +1,44 @@
+package commons
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GroupPolicyConfig is a policy for members of an iRODS group
+// A user in many groups gets the most restrictive values of their policies.
+type GroupPolicyConfig struct {
+	// Group is an iRODS group name
+	Group string `yaml:"group" json:"group"`
+	// AllowedProtocols are protocols members can log in over, all protocols if not given
+	AllowedProtocols []string `yaml:"allowed_protocols" json:"allowed_protocols"`
+	// ReadOnly limits members to list and download on mounts
+	ReadOnly bool `yaml:"readonly" json:"readonly"`
+	// UserMaxLifetime is how long SFTPGo users of members are valid after login in seconds, no limit if 0
+	UserMaxLifetime int `yaml:"user_max_lifetime" json:"user_max_lifetime"`
+}
+
+func (config *Config) validateGroupPolicies() error {
+	groups := map[string]bool{}
+	for idx, policy := range config.GroupPolicies {
+		if len(policy.Group) == 0 {
+			return config.fieldError("GroupPolicies", fmt.Sprintf("group policy %d has no group", idx))
+		}
+
+		if groups[policy.Group] {
+			return config.fieldError("GroupPolicies", fmt.Sprintf("group policy of group %q is duplicated", policy.Group))
+		}
+		groups[policy.Group] = true
+
+		for _, protocol := range policy.AllowedProtocols {
+			if !IsSFTPGoProtocol(protocol) {
+				return config.fieldError("GroupPolicies", fmt.Sprintf("group policy of group %q has protocol %q, must be one of %s", policy.Group, protocol, strings.Join(SFTPGoProtocols, ", ")))
+			}
+		}
+
+		if policy.UserMaxLifetime < 0 {
+			return config.fieldError("GroupPolicies", fmt.Sprintf("group policy of group %q has negative user max lifetime", policy.Group))
+		}
+	}
+	return nil
+}
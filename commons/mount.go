@@ -0,0 +1,204 @@
+package commons
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// mount template placeholders
+const (
+	MountPlaceholderZone  string = "{zone}"
+	MountPlaceholderUser  string = "{user}"
+	MountPlaceholderHome  string = "{home}"
+	MountPlaceholderGroup string = "{group}"
+)
+
+// mount condition user kinds
+const (
+	MountUsersAuthenticated string = "authenticated"
+	MountUsersAnonymous     string = "anonymous"
+	MountUsersAll           string = "all"
+)
+
+// nameRegexp matches names that become a part of SFTPGo user names and virtual folder names
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// IsValidName checks if the name can be a part of SFTPGo user names and virtual folder names, such as mount names and key names
+func IsValidName(name string) bool {
+	return nameRegexp.MatchString(name)
+}
+
+// sampleMountValues are values to check mount templates
+var sampleMountValues = MountValues{
+	Zone:  "zone",
+	User:  "user",
+	Home:  "/zone/home/user",
+	Group: "group",
+}
+
+// MountConfig is a template of a collection to mount
+// Name, DirName, Description and CollectionPath can have placeholders {zone}, {user}, {home} and {group}.
+// A template having {group} is mounted for each group of the user, so its name and dir name must have {group} too.
+type MountConfig struct {
+	// Name is used in virtual folder names, must be unique among mounts
+	Name string `yaml:"name" json:"name"`
+	// DirName is a dir name in user's root dir
+	DirName        string `yaml:"dir_name" json:"dir_name"`
+	Description    string `yaml:"description" json:"description"`
+	CollectionPath string `yaml:"collection_path" json:"collection_path"`
+	// RequireCollection mounts only if the collection exists
+	RequireCollection bool `yaml:"require_collection" json:"require_collection"`
+	// When is a condition to mount, all given fields must match
+	When MountCondition `yaml:"when" json:"when"`
+}
+
+// MountCondition is a condition to mount a template
+type MountCondition struct {
+	// Users is one of authenticated, anonymous or all, authenticated if not given
+	Users string `yaml:"users" json:"users"`
+	// AuthMethods are password, keyboard-interactive or publickey
+	AuthMethods []string `yaml:"auth_methods" json:"auth_methods"`
+	// Protocols are SFTPGo protocols
+	Protocols []string `yaml:"protocols" json:"protocols"`
+	// Groups are iRODS groups, the user must be a member of any of them
+	Groups []string `yaml:"groups" json:"groups"`
+}
+
+// MountValues are values of placeholders in mount templates
+type MountValues struct {
+	Zone  string
+	User  string
+	Home  string
+	Group string
+}
+
+// HasGroupPlaceholder checks if the template is mounted for each group
+func (mount *MountConfig) HasGroupPlaceholder() bool {
+	for _, value := range []string{mount.Name, mount.DirName, mount.Description, mount.CollectionPath} {
+		if strings.Contains(value, MountPlaceholderGroup) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns a copy of the template with placeholders replaced by the values
+func (mount *MountConfig) Expand(values MountValues) MountConfig {
+	replacer := strings.NewReplacer(
+		MountPlaceholderZone, values.Zone,
+		MountPlaceholderUser, values.User,
+		MountPlaceholderHome, values.Home,
+		MountPlaceholderGroup, values.Group,
+	)
+
+	expanded := *mount
+	expanded.Name = replacer.Replace(mount.Name)
+	expanded.DirName = replacer.Replace(mount.DirName)
+	expanded.Description = replacer.Replace(mount.Description)
+	expanded.CollectionPath = replacer.Replace(mount.CollectionPath)
+	return expanded
+}
+
+// Validate checks the expanded template
+func (mount *MountConfig) Validate() error {
+	if !IsValidName(mount.Name) {
+		return fmt.Errorf("mount has invalid name %q, must consist of letters, digits, '.', '_' and '-'", mount.Name)
+	}
+	if len(mount.DirName) == 0 || strings.Contains(mount.DirName, "/") || mount.DirName == "." || mount.DirName == ".." {
+		return fmt.Errorf("mount %q has invalid dir name %q", mount.Name, mount.DirName)
+	}
+	if !path.IsAbs(mount.CollectionPath) {
+		return fmt.Errorf("mount %q has collection path %q that is not absolute", mount.Name, mount.CollectionPath)
+	}
+	return nil
+}
+
+// IsPathUnder checks if the collection path is the parent path or under it
+func IsPathUnder(collectionPath string, parentPath string) bool {
+	if collectionPath == parentPath {
+		return true
+	}
+	return strings.HasPrefix(collectionPath, strings.TrimSuffix(parentPath, "/")+"/")
+}
+
+// GetProjectMountTemplate returns a template of project mounts, mounted for each group of the user having a project collection
+func (config *Config) GetProjectMountTemplate() MountConfig {
+	return MountConfig{
+		Name:              "project_" + MountPlaceholderGroup,
+		DirName:           MountPlaceholderGroup,
+		Description:       "iRODS project " + MountPlaceholderGroup,
+		CollectionPath:    config.ProjectCollectionPath,
+		RequireCollection: true,
+	}
+}
+
+func (config *Config) validateProjectMounts() error {
+	if !config.ProjectMounts {
+		return nil
+	}
+
+	if !strings.Contains(config.ProjectCollectionPath, MountPlaceholderGroup) {
+		return config.fieldError("ProjectCollectionPath", fmt.Sprintf("project collection path %q does not have %s", config.ProjectCollectionPath, MountPlaceholderGroup))
+	}
+
+	template := config.GetProjectMountTemplate()
+	expanded := template.Expand(sampleMountValues)
+	if strings.ContainsAny(expanded.CollectionPath, "{}") {
+		return config.fieldError("ProjectCollectionPath", fmt.Sprintf("project collection path %q has an unknown placeholder", config.ProjectCollectionPath))
+	}
+
+	err := expanded.Validate()
+	if err != nil {
+		return config.fieldError("ProjectCollectionPath", err.Error())
+	}
+	return nil
+}
+
+func (config *Config) validateMounts() error {
+	names := map[string]bool{}
+	for idx, mount := range config.Mounts {
+		if mount.HasGroupPlaceholder() && (!strings.Contains(mount.Name, MountPlaceholderGroup) || !strings.Contains(mount.DirName, MountPlaceholderGroup)) {
+			return config.fieldError("Mounts", fmt.Sprintf("mount %d has %s, but not in both of the name and the dir name", idx, MountPlaceholderGroup))
+		}
+
+		expanded := mount.Expand(sampleMountValues)
+		for _, value := range []string{expanded.Name, expanded.DirName, expanded.Description, expanded.CollectionPath} {
+			if strings.ContainsAny(value, "{}") {
+				return config.fieldError("Mounts", fmt.Sprintf("mount %d has an unknown placeholder in %q", idx, value))
+			}
+		}
+
+		err := expanded.Validate()
+		if err != nil {
+			return config.fieldError("Mounts", fmt.Sprintf("mount %d: %s", idx, err.Error()))
+		}
+
+		if names[mount.Name] {
+			return config.fieldError("Mounts", fmt.Sprintf("mount name %q is duplicated", mount.Name))
+		}
+		names[mount.Name] = true
+
+		switch strings.ToLower(mount.When.Users) {
+		case "", MountUsersAuthenticated, MountUsersAnonymous, MountUsersAll:
+		default:
+			return config.fieldError("Mounts", fmt.Sprintf("mount %q has users condition %q, must be one of authenticated, anonymous or all", mount.Name, mount.When.Users))
+		}
+
+		for _, authMethod := range mount.When.AuthMethods {
+			switch strings.ToLower(authMethod) {
+			case AuditMethodPassword, AuditMethodKeyboardInteractive, AuditMethodPublicKey:
+			default:
+				return config.fieldError("Mounts", fmt.Sprintf("mount %q has auth method condition %q, must be one of password, keyboard-interactive or publickey", mount.Name, authMethod))
+			}
+		}
+
+		for _, protocol := range mount.When.Protocols {
+			if !IsSFTPGoProtocol(protocol) {
+				return config.fieldError("Mounts", fmt.Sprintf("mount %q has protocol condition %q, must be one of %s", mount.Name, protocol, strings.Join(SFTPGoProtocols, ", ")))
+			}
+		}
+	}
+	return nil
+}
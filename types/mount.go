@@ -5,4 +5,6 @@ type MountPath struct {
 	DirName        string
 	Description    string
 	CollectionPath string
+	// Permissions limit SFTPGo permissions on the mount, not limited if nil
+	Permissions []string
 }
@@ -0,0 +1,131 @@
+package types
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	secretKeySize       int = 32
+	secretboxNonceSize  int = 24
+	masterKeySecretMode int = 1
+)
+
+// secretRandReader gives data keys and nonces, tests replace it to check fixed vectors
+var secretRandReader io.Reader = rand.Reader
+
+// NewSFTPGoSecretAES256GCM returns a new SFTPGoSecret with payload encrypted in AES-256-GCM, and its data key encrypted with the master key
+// SFTPGo must use the same master key to decrypt it
+func NewSFTPGoSecretAES256GCM(payload string, additionalData string, masterKey []byte) (*SFTPGoSecret, error) {
+	return newSFTPGoSecretEncrypted(aes256GCMSecretStatus, payload, additionalData, masterKey)
+}
+
+// NewSFTPGoSecretSecretbox returns a new SFTPGoSecret with payload encrypted in NaCl secretbox, as SFTPGo's local KMS does with a master key
+// SFTPGo must use the same master key to decrypt it
+func NewSFTPGoSecretSecretbox(payload string, additionalData string, masterKey []byte) (*SFTPGoSecret, error) {
+	return newSFTPGoSecretEncrypted(secretboxSecretStatus, payload, additionalData, masterKey)
+}
+
+// GetRedacted returns a redacted SFTPGoSecret
+func (secret *SFTPGoSecret) GetRedacted() *SFTPGoSecret {
+	newSecret := *secret
+	if len(newSecret.Payload) > 0 {
+		newSecret.Payload = redactedSecretPayload
+	}
+	if len(newSecret.Key) > 0 {
+		newSecret.Key = redactedSecretPayload
+	}
+	return &newSecret
+}
+
+// newSFTPGoSecretEncrypted encrypts payload with a random data key, then encrypts the data key with master key.
+// Both keys are derived with HKDF-SHA256 using additional data as info.
+func newSFTPGoSecretEncrypted(status string, payload string, additionalData string, masterKey []byte) (*SFTPGoSecret, error) {
+	if len(masterKey) == 0 {
+		return nil, errors.New("master key is not given")
+	}
+
+	dataKey := make([]byte, secretKeySize)
+	_, err := io.ReadFull(secretRandReader, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadKey, err := hkdf.Key(sha256.New, dataKey, nil, additionalData, secretKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedPayload, err := sealSecret(status, []byte(payload), []byte(additionalData), payloadKey)
+	if err != nil {
+		return nil, err
+	}
+
+	derivedMasterKey, err := hkdf.Key(sha256.New, masterKey, nil, additionalData, secretKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedDataKey, err := sealSecret(status, dataKey, []byte(additionalData), derivedMasterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SFTPGoSecret{
+		Status:         status,
+		Payload:        hex.EncodeToString(encryptedPayload),
+		Key:            hex.EncodeToString(encryptedDataKey),
+		AdditionalData: additionalData,
+		Mode:           masterKeySecretMode,
+	}, nil
+}
+
+// sealSecret encrypts plaintext with key, the result is prefixed with the nonce
+// Additional data is authenticated in AES-256-GCM only, as SFTPGo does
+func sealSecret(status string, plaintext []byte, additionalData []byte, key []byte) ([]byte, error) {
+	switch status {
+	case aes256GCMSecretStatus:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		_, err = io.ReadFull(secretRandReader, nonce)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(additionalData) == 0 {
+			additionalData = nil
+		}
+		return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+	case secretboxSecretStatus:
+		var nonce [secretboxNonceSize]byte
+		_, err := io.ReadFull(secretRandReader, nonce[:])
+		if err != nil {
+			return nil, err
+		}
+
+		var secretKey [secretKeySize]byte
+		copy(secretKey[:], key)
+
+		return secretbox.Seal(nonce[:], plaintext, &nonce, &secretKey), nil
+	default:
+		return nil, fmt.Errorf("unknown secret status %s", status)
+	}
+}
@@ -0,0 +1,114 @@
+package types
+
+import (
+	"testing"
+)
+
+// countingReader gives bytes 0, 1, 2, ... so that data keys and nonces are fixed
+type countingReader struct {
+	next byte
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = reader.next
+		reader.next++
+	}
+	return len(p), nil
+}
+
+func setTestSecretRandReader(t *testing.T) {
+	original := secretRandReader
+	secretRandReader = &countingReader{}
+	t.Cleanup(func() {
+		secretRandReader = original
+	})
+}
+
+// Vectors are made by testdata/secret_vectors.py, apart from this package,
+// with HKDF-SHA256 over Python's hmac, AES-256-GCM of OpenSSL's libcrypto and crypto_secretbox_easy of libsodium
+func TestNewSFTPGoSecret(t *testing.T) {
+	masterKey := []byte("master key\n")
+
+	tests := []struct {
+		name           string
+		newSecret      func(payload string, additionalData string, masterKey []byte) (*SFTPGoSecret, error)
+		status         string
+		additionalData string
+		wantPayload    string
+		wantKey        string
+	}{
+		{
+			"aes-256-gcm", NewSFTPGoSecretAES256GCM, "AES-256-GCM", "user1",
+			"202122232425262728292a2b889c9bf32de2c69754e615f06c57c0a1d5fa4e17e31ef8a3",
+			"2c2d2e2f30313233343536372c312f8446e9bcb9040ad542c51b22a1406592dd480e38452c3a555c2e3cd1beba225003bc81ae77fbff92f513044cc0",
+		},
+		{
+			"aes-256-gcm without additional data", NewSFTPGoSecretAES256GCM, "AES-256-GCM", "",
+			"202122232425262728292a2b5c9694c786c2f3a285e3e6c8f57a066413cf8c6dc14c5bd6",
+			"2c2d2e2f3031323334353637a2b70318ff7fe00285052907394d0eb7e729af9e61a2369b3902142c7474a853e8b5e9f123dafd2a72d4573dcf479de2",
+		},
+		{
+			"secretbox", NewSFTPGoSecretSecretbox, "Secretbox", "user1",
+			"202122232425262728292a2b2c2d2e2f3031323334353637be40317d2ccec9562fa1e87f7260e1524fb4aa0d81ea43b4",
+			"38393a3b3c3d3e3f404142434445464748494a4b4c4d4e4f5e7fc4068636184af6d6b0d49daa416c4b26261d5be4957dede058449ddc41d00a9c3856c2b5ea913749176378037edc",
+		},
+		{
+			"secretbox without additional data", NewSFTPGoSecretSecretbox, "Secretbox", "",
+			"202122232425262728292a2b2c2d2e2f3031323334353637de741228eab7286af7fc77dd03ba2f316997b9ecd5aa5c1a",
+			"38393a3b3c3d3e3f404142434445464748494a4b4c4d4e4f1905404ffe6f2288826f572b021cea2d6bfb9fa7009faff5a4dc365c78a5e5658895e7e26849b41c17301e3f83c37303",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestSecretRandReader(t)
+
+			secret, err := test.newSecret("password", test.additionalData, masterKey)
+			if err != nil {
+				t.Fatalf("failed to encrypt: %v", err)
+			}
+
+			want := SFTPGoSecret{
+				Status:         test.status,
+				Payload:        test.wantPayload,
+				Key:            test.wantKey,
+				AdditionalData: test.additionalData,
+				Mode:           1,
+			}
+			if *secret != want {
+				t.Errorf("secret = %+v, want %+v", *secret, want)
+			}
+		})
+	}
+}
+
+func TestNewSFTPGoSecretRequiresMasterKey(t *testing.T) {
+	_, err := NewSFTPGoSecretAES256GCM("password", "user1", nil)
+	if err == nil {
+		t.Errorf("encrypted in AES-256-GCM without a master key")
+	}
+
+	_, err = NewSFTPGoSecretSecretbox("password", "user1", []byte{})
+	if err == nil {
+		t.Errorf("encrypted in secretbox without a master key")
+	}
+}
+
+func TestSFTPGoSecretGetRedacted(t *testing.T) {
+	secret, err := NewSFTPGoSecretSecretbox("irods password", "user1", []byte("master key"))
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	redacted := secret.GetRedacted()
+	if redacted.Payload != redactedSecretPayload || redacted.Key != redactedSecretPayload {
+		t.Errorf("payload and key are not redacted: %+v", redacted)
+	}
+	if redacted.Status != secret.Status || redacted.AdditionalData != secret.AdditionalData || redacted.Mode != secret.Mode {
+		t.Errorf("redacted secret has different metadata: %+v", redacted)
+	}
+	if secret.Payload == redactedSecretPayload {
+		t.Errorf("original secret is changed")
+	}
+}
@@ -7,13 +7,17 @@ import (
 )
 
 const (
-	plainSecretStatus = "Plain"
+	plainSecretStatus     = "Plain"
+	aes256GCMSecretStatus = "AES-256-GCM"
+	secretboxSecretStatus = "Secretbox"
+	redactedSecretPayload = "<redacted>"
 )
 
 // SFTPGoUser is a user filter data type for SFTPGo
 type SFTPGoUserFilter struct {
 	AllowedIP          []string `json:"allowed_ip,omitempty"`
 	DeniedLoginMethods []string `json:"denied_login_methods,omitempty"`
+	DeniedProtocols    []string `json:"denied_protocols,omitempty"`
 }
 
 // SFTPGoSecret is a secret data type for SFTPGo
@@ -42,19 +46,15 @@ type SFTPGoIRODSFsConfig struct {
 	SSLAlgorithm                   string        `json:"ssl_algorithm,omitempty"`
 	SSLSaltSize                    int           `json:"ssl_salt_size,omitempty"`
 	SSLHashRounds                  int           `json:"ssl_hash_rounds,omitempty"`
+	SSLVerifyServer                string        `json:"ssl_verify_server,omitempty"`
+	SSLServerName                  string        `json:"ssl_server_name,omitempty"`
 }
 
 // GetRedacted returns a redacted SFTPGoIRODSFsConfig
 func (config *SFTPGoIRODSFsConfig) GetRedacted() *SFTPGoIRODSFsConfig {
 	newConfig := *config
-	if newConfig.Password != nil && len(newConfig.Password.Payload) > 0 {
-		newConfig.Password = &SFTPGoSecret{
-			Status:         plainSecretStatus,
-			Payload:        "<redacted>",
-			Key:            "",
-			AdditionalData: "",
-			Mode:           0,
-		}
+	if newConfig.Password != nil {
+		newConfig.Password = newConfig.Password.GetRedacted()
 	}
 	return &newConfig
 }
@@ -99,6 +99,8 @@ type SFTPGoUser struct {
 	Permissions    map[string][]string   `json:"permissions"`
 	Filters        *SFTPGoUserFilter     `json:"filters"`
 	FileSystem     *SFTPGoFileSystem     `json:"filesystem"`
+	// ExpirationDate is unix time in milliseconds when the user expires, 0 means no expiration
+	ExpirationDate int64 `json:"expiration_date,omitempty"`
 }
 
 // GetRedacted returns a redacted SFTPGoUser
@@ -127,6 +129,39 @@ func (user *SFTPGoUser) GetRedactedJSONString() string {
 	return string(resp)
 }
 
+// SFTPGoExternalAuthRequest is a request body that SFTPGo posts to an HTTP external auth hook
+type SFTPGoExternalAuthRequest struct {
+	Username            string `json:"username"`
+	IP                  string `json:"ip"`
+	Protocol            string `json:"protocol"`
+	Password            string `json:"password,omitempty"`
+	PublicKey           string `json:"public_key,omitempty"`
+	KeyboardInteractive string `json:"keyboard_interactive,omitempty"`
+	TLSCert             string `json:"tls_cert,omitempty"`
+}
+
+// SFTPGoKeyboardInteractiveRequest is a request body that SFTPGo posts to an HTTP keyboard interactive hook
+type SFTPGoKeyboardInteractiveRequest struct {
+	RequestID string `json:"request_id"`
+	// Step starts from 1, answers are given from step 2
+	Step      int      `json:"step"`
+	Username  string   `json:"username"`
+	IP        string   `json:"ip"`
+	Password  string   `json:"password,omitempty"`
+	Answers   []string `json:"answers,omitempty"`
+	Questions []string `json:"questions,omitempty"`
+}
+
+// SFTPGoKeyboardInteractiveResponse is a response that a keyboard interactive hook writes to SFTPGo
+type SFTPGoKeyboardInteractiveResponse struct {
+	Instruction string   `json:"instruction"`
+	Questions   []string `json:"questions"`
+	Echos       []bool   `json:"echos"`
+	// 1 means auth success, -1 means auth failure, 0 means more questions
+	AuthResult    int `json:"auth_result"`
+	CheckPassword int `json:"check_password"`
+}
+
 // NewSFTPGoUserForError returns a new SFTPGoUser for auth failure
 func NewSFTPGoUserForError() *SFTPGoUser {
 	return &SFTPGoUser{
@@ -134,6 +169,13 @@ func NewSFTPGoUserForError() *SFTPGoUser {
 	}
 }
 
+// NewSFTPGoKeyboardInteractiveResponseForError returns a new SFTPGoKeyboardInteractiveResponse for auth failure
+func NewSFTPGoKeyboardInteractiveResponseForError() *SFTPGoKeyboardInteractiveResponse {
+	return &SFTPGoKeyboardInteractiveResponse{
+		AuthResult: -1,
+	}
+}
+
 // NewSFTPGoSecretForUserPassword returns a new SFTPGoSecret for storing user password
 func NewSFTPGoSecretForUserPassword(password string) *SFTPGoSecret {
 	return &SFTPGoSecret{
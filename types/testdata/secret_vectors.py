@@ -0,0 +1,92 @@
+#!/usr/bin/env python3
+"""Makes the fixed vectors of types/secret_test.go, apart from the Go code under test.
+
+HKDF-SHA256 is computed with Python's hmac, AES-256-GCM with OpenSSL's libcrypto
+and secretbox with libsodium's crypto_secretbox_easy. Random bytes are replaced with
+the counting stream 0, 1, 2, ... that the tests give to secretRandReader.
+
+Run: python3 types/testdata/secret_vectors.py
+"""
+
+import ctypes
+import ctypes.util
+import hashlib
+import hmac
+
+crypto = ctypes.CDLL(ctypes.util.find_library("crypto"))
+sodium = ctypes.CDLL(ctypes.util.find_library("sodium"))
+sodium.sodium_init()
+
+crypto.EVP_CIPHER_CTX_new.restype = ctypes.c_void_p
+crypto.EVP_aes_256_gcm.restype = ctypes.c_void_p
+crypto.EVP_CIPHER_CTX_free.argtypes = [ctypes.c_void_p]
+
+EVP_CTRL_GCM_GET_TAG = 0x10
+
+
+class CountingStream:
+    def __init__(self):
+        self.next = 0
+
+    def read(self, size):
+        data = bytes((self.next + i) % 256 for i in range(size))
+        self.next += size
+        return data
+
+
+def hkdf_sha256(key, info, size=32):
+    prk = hmac.new(b"\0" * 32, key, hashlib.sha256).digest()
+    output, block, counter = b"", b"", 1
+    while len(output) < size:
+        block = hmac.new(prk, block + info + bytes([counter]), hashlib.sha256).digest()
+        output += block
+        counter += 1
+    return output[:size]
+
+
+def seal_aes_256_gcm(key, nonce, plaintext, additional_data):
+    ctx = ctypes.c_void_p(crypto.EVP_CIPHER_CTX_new())
+    try:
+        assert crypto.EVP_EncryptInit_ex(ctx, ctypes.c_void_p(crypto.EVP_aes_256_gcm()), None, key, nonce) == 1
+        size = ctypes.c_int(0)
+        if additional_data:
+            assert crypto.EVP_EncryptUpdate(ctx, None, ctypes.byref(size), additional_data, len(additional_data)) == 1
+        ciphertext = ctypes.create_string_buffer(len(plaintext) + 16)
+        assert crypto.EVP_EncryptUpdate(ctx, ciphertext, ctypes.byref(size), plaintext, len(plaintext)) == 1
+        written = size.value
+        assert crypto.EVP_EncryptFinal_ex(ctx, ctypes.byref(ciphertext, written), ctypes.byref(size)) == 1
+        tag = ctypes.create_string_buffer(16)
+        assert crypto.EVP_CIPHER_CTX_ctrl(ctx, EVP_CTRL_GCM_GET_TAG, 16, tag) == 1
+        return nonce + ciphertext.raw[:written] + tag.raw
+    finally:
+        crypto.EVP_CIPHER_CTX_free(ctx)
+
+
+def seal_secretbox(key, nonce, plaintext):
+    ciphertext = ctypes.create_string_buffer(len(plaintext) + 16)
+    assert sodium.crypto_secretbox_easy(ciphertext, plaintext, ctypes.c_ulonglong(len(plaintext)), nonce, key) == 0
+    return nonce + ciphertext.raw
+
+
+def make_secret(status, payload, additional_data, master_key):
+    stream = CountingStream()
+    data_key = stream.read(32)
+
+    payload_key = hkdf_sha256(data_key, additional_data)
+    master_data_key = hkdf_sha256(master_key, additional_data)
+    if status == "AES-256-GCM":
+        encrypted_payload = seal_aes_256_gcm(payload_key, stream.read(12), payload, additional_data)
+        encrypted_key = seal_aes_256_gcm(master_data_key, stream.read(12), data_key, additional_data)
+    else:
+        encrypted_payload = seal_secretbox(payload_key, stream.read(24), payload)
+        encrypted_key = seal_secretbox(master_data_key, stream.read(24), data_key)
+    return encrypted_payload.hex(), encrypted_key.hex()
+
+
+if __name__ == "__main__":
+    master_key = b"master key\n"
+    for status, additional_data in [("AES-256-GCM", b"user1"), ("AES-256-GCM", b""), ("Secretbox", b"user1"), ("Secretbox", b"")]:
+        payload, key = make_secret(status, b"password", additional_data, master_key)
+        print(f"{status} additional data {additional_data.decode()!r}")
+        print(f"  payload {payload}")
+        print(f"  key     {key}")